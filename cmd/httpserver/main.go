@@ -1,113 +1,79 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"errors"
-	"fmt"
-	"io"
+	"context"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
-	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/accesslog"
+	"github.com/MrBhop/httpfromtcp/internal/middleware"
+	"github.com/MrBhop/httpfromtcp/internal/proxy"
 	"github.com/MrBhop/httpfromtcp/internal/request"
 	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/router"
 	"github.com/MrBhop/httpfromtcp/internal/server"
 )
 
-const port = 42069
+const (
+	port = 42069
+	shutdownTimeout = 10 * time.Second
+)
 
 func main() {
-	server, err := server.Serve(port, handlerFunc)
+	server, err := server.Serve(
+		port,
+		server.Chain(
+			newRouter().Serve,
+			middleware.Recover(),
+			middleware.RequestID(),
+		),
+		server.WithReadHeaderTimeout(10 * time.Second),
+		server.WithReadBodyTimeout(time.Minute),
+		server.WithWriteTimeout(time.Minute),
+		server.WithIdleTimeout(2 * time.Minute),
+		server.WithAccessLog(accesslog.New(os.Stdout, accesslog.FormatCombined)),
+	)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handlerFunc(w *response.Writer, request *request.Request) {
-	switch request.RequestLine.RequestTarget {
-	case "/yourproblem":
-		yourProblemHandler(w)
-	case "/myproblem":
-		myProblemHandler(w)
-	}
-	if strings.HasPrefix(request.RequestLine.RequestTarget, "/httpbin/") {
-		httpBinHandler(w, request.RequestLine.RequestTarget)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 		return
 	}
-	if request.RequestLine.RequestTarget == "/video" && request.RequestLine.Method == "GET" {
-		videoHandler(w)
-		return
-	}
-	okHandler(w)
+	log.Println("Server gracefully stopped")
 }
 
-func httpBinHandler(w *response.Writer, target string) {
-	fmt.Println("proxying to httpbin.org")
-	nResponsesString := strings.TrimPrefix(target, "/httpbin/")
-
-	resp, err := http.Get(fmt.Sprintf("https://httpbin.org/%s", nResponsesString))
-	if err != nil {
+func newRouter() *router.Router {
+	r := router.New()
+	r.HandleAll("/yourproblem", func(w *response.Writer, _ *request.Request) {
+		yourProblemHandler(w)
+	})
+	r.HandleAll("/myproblem", func(w *response.Writer, _ *request.Request) {
 		myProblemHandler(w)
-		return
-	}
-	defer resp.Body.Close()
-
-	h := response.GetDefaultHeaders(0)
-	h.Remove("Content-Length")
-	h.Set("Content-Type", resp.Header.Get("Content-Type"))
-	h.Set("Transfer-Encoding", "chunked")
-	h.Set("Trailer", "X-Content-Sha256, X-Content-Length")
-
-	w.WriteStatusLine(response.StatusOK)
-	w.WriteHeaders(h)
-
-	buffer := make([]byte, 32)
-	bufferLengthUsed := 0
-	for {
-		if bufferLengthUsed == len(buffer) {
-			newBuffer := make([]byte, bufferLengthUsed * 2)
-			copy(newBuffer, buffer)
-			buffer = newBuffer
-		}
-		n, err := resp.Body.Read(buffer[bufferLengthUsed:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				log.Printf("Reached end of file after %d bytes\n", bufferLengthUsed + n)
-				break
-			}
-			log.Printf("Error reading from forwarded request: %s", err)
-			break
-		}
-		fmt.Println("Read", n, "bytes.", "Total bytes read: ", bufferLengthUsed + n)
-		fmt.Printf("Bytes Read:\n%s\n", buffer[bufferLengthUsed:][:n])
-
-		if _, err := w.WriteChunkedBody(buffer[bufferLengthUsed:][:n]); err != nil {
-			log.Println(err)
-			break
-		}
-		bufferLengthUsed += n
-	}
-	if err := w.WriteChunkedBodyDone(false); err != nil {
-		log.Println(err)
+	})
+	httpBin, err := proxy.New([]string{"https://httpbin.org"}, proxy.WithStripPrefix("/httpbin"))
+	if err != nil {
+		log.Fatalf("Error creating httpbin proxy: %v", err)
 	}
-
-	checksum := sha256.Sum256(buffer[:bufferLengthUsed])
-	trailers := headers.NewHeaders()
-	trailers.Set("X-Content-SHA256", hex.EncodeToString(checksum[:]))
-	trailers.Set("X-Content-Length", fmt.Sprintf("%d", bufferLengthUsed))
-	w.WriteTrailers(trailers)
+	r.HandleAll("/httpbin/{path...}", httpBin.Serve)
+	r.Handle("GET", "/video", func(w *response.Writer, _ *request.Request) {
+		videoHandler(w)
+	})
+	r.HandleAll("/{path...}", func(w *response.Writer, _ *request.Request) {
+		okHandler(w)
+	})
+	return r
 }
 
 func videoHandler(w *response.Writer) {
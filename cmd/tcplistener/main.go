@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
 
@@ -37,11 +38,15 @@ func main() {
 		fmt.Printf("- Target: %s\n", request.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", request.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for key, value := range request.Headers {
-			fmt.Printf("- %s: %s\n", key, value)
+		for _, field := range request.Headers.Fields() {
+			fmt.Printf("- %s: %s\n", field.Name, field.Value)
+		}
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			log.Fatalf("Error reading body: %s", err)
 		}
 		fmt.Println("Body:")
-		fmt.Printf("%s\n", request.Body)
+		fmt.Printf("%s\n", body)
 
 		fmt.Println("Connection to", conn.RemoteAddr(), "closed!")
 	}
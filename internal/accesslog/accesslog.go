@@ -0,0 +1,168 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Format int
+
+const (
+	// FormatCommon is the Common Log Format:
+	// host ident authuser [date] "request line" status bytes
+	FormatCommon Format = iota
+	// FormatCombined is the Common Log Format followed by the quoted Referer
+	// and User-Agent headers.
+	FormatCombined
+	// FormatJSON writes one JSON object per line.
+	FormatJSON
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Entry describes a single request and its response. Method, Target and
+// Protocol are empty if the request could not be parsed.
+type Entry struct {
+	Time time.Time
+	RemoteAddr string
+	Method string
+	Target string
+	Protocol string
+	Status int
+	BytesWritten int
+	Duration time.Duration
+	UserAgent string
+	Referer string
+}
+
+type Logger struct {
+	mu sync.Mutex
+	out io.Writer
+	format Format
+}
+
+func New(out io.Writer, format Format) *Logger {
+	return &Logger{
+		out: out,
+		format: format,
+	}
+}
+
+// Log writes entry as a single line. It is safe for concurrent use.
+func (l *Logger) Log(entry Entry) error {
+	line, err := l.formatEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(line)
+	return err
+}
+
+func (l *Logger) formatEntry(entry Entry) ([]byte, error) {
+	switch l.format {
+	case FormatCommon:
+		return append(formatCommon(entry), '\n'), nil
+	case FormatCombined:
+		line := formatCommon(entry)
+		line = fmt.Appendf(line, " \"%s\" \"%s\"\n", escape(orDash(entry.Referer)), escape(orDash(entry.UserAgent)))
+		return line, nil
+	case FormatJSON:
+		return formatJSON(entry)
+	default:
+		return nil, fmt.Errorf("Unknown access log format %d", l.format)
+	}
+}
+
+func formatCommon(entry Entry) []byte {
+	requestLine := "-"
+	if entry.Method != "" {
+		requestLine = fmt.Sprintf("%s %s %s", entry.Method, entry.Target, entry.Protocol)
+	}
+
+	bytesWritten := "-"
+	if entry.BytesWritten > 0 {
+		bytesWritten = strconv.Itoa(entry.BytesWritten)
+	}
+
+	return fmt.Appendf(nil, "%s - - [%s] \"%s\" %d %s",
+		orDash(remoteHost(entry.RemoteAddr)),
+		entry.Time.Format(clfTimeLayout),
+		escape(requestLine),
+		entry.Status,
+		bytesWritten,
+	)
+}
+
+type jsonEntry struct {
+	Time string `json:"time"`
+	RemoteAddr string `json:"remote_addr"`
+	Method string `json:"method"`
+	Target string `json:"target"`
+	Protocol string `json:"protocol"`
+	Status int `json:"status"`
+	BytesWritten int `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	UserAgent string `json:"user_agent"`
+	Referer string `json:"referer"`
+}
+
+func formatJSON(entry Entry) ([]byte, error) {
+	line, err := json.Marshal(jsonEntry{
+		Time: entry.Time.Format(time.RFC3339Nano),
+		RemoteAddr: entry.RemoteAddr,
+		Method: entry.Method,
+		Target: entry.Target,
+		Protocol: entry.Protocol,
+		Status: entry.Status,
+		BytesWritten: entry.BytesWritten,
+		DurationMs: float64(entry.Duration) / float64(time.Millisecond),
+		UserAgent: entry.UserAgent,
+		Referer: entry.Referer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape keeps client controlled values from breaking the line format by
+// escaping quotes, backslashes and non-printable bytes.
+func escape(s string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&escaped, "\\x%02x", c)
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
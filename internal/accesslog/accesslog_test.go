@@ -0,0 +1,70 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	entry := Entry{
+		Time: time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7 * 60 * 60)),
+		RemoteAddr: "127.0.0.1:54321",
+		Method: "GET",
+		Target: "/apache_pb.gif",
+		Protocol: "HTTP/1.1",
+		Status: 200,
+		BytesWritten: 2326,
+		Duration: 1500 * time.Microsecond,
+		UserAgent: "Mozilla/4.08 [en] (Win98; I ;Nav)",
+		Referer: "http://www.example.com/start.html",
+	}
+
+	// Test: Common Log Format
+	out := &bytes.Buffer{}
+	require.NoError(t, New(out, FormatCommon).Log(entry))
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 2326` + "\n", out.String())
+
+	// Test: Combined Log Format
+	out.Reset()
+	require.NoError(t, New(out, FormatCombined).Log(entry))
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"` + "\n", out.String())
+
+	// Test: JSON lines
+	out.Reset()
+	logger := New(out, FormatJSON)
+	require.NoError(t, logger.Log(entry))
+	require.NoError(t, logger.Log(entry))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	decoded := map[string]any{}
+	require.NoError(t, json.Unmarshal(lines[0], &decoded))
+	assert.Equal(t, "2000-10-10T13:55:36-07:00", decoded["time"])
+	assert.Equal(t, "127.0.0.1:54321", decoded["remote_addr"])
+	assert.Equal(t, "GET", decoded["method"])
+	assert.Equal(t, "/apache_pb.gif", decoded["target"])
+	assert.Equal(t, "HTTP/1.1", decoded["protocol"])
+	assert.Equal(t, float64(200), decoded["status"])
+	assert.Equal(t, float64(2326), decoded["bytes"])
+	assert.Equal(t, 1.5, decoded["duration_ms"])
+	assert.Equal(t, "Mozilla/4.08 [en] (Win98; I ;Nav)", decoded["user_agent"])
+
+	// Test: Unparsed request, no body and missing headers
+	out.Reset()
+	require.NoError(t, New(out, FormatCombined).Log(Entry{
+		Time: entry.Time,
+		RemoteAddr: "[::1]:1234",
+		Status: 400,
+	}))
+	assert.Equal(t, `::1 - - [10/Oct/2000:13:55:36 -0700] "-" 400 - "-" "-"` + "\n", out.String())
+
+	// Test: Client controlled values are escaped
+	out.Reset()
+	entry.UserAgent = "evil\" \"agent\n"
+	require.NoError(t, New(out, FormatCombined).Log(entry))
+	assert.Contains(t, out.String(), `"evil\" \"agent\x0a"`)
+}
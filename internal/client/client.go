@@ -0,0 +1,348 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+var (
+	ErrMissingHost = errors.New("Request has no host to connect to")
+	ErrTooManyRedirects = errors.New("Too many redirects")
+)
+
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultIdleTimeout = 90 * time.Second
+	defaultMaxIdleConnsPerHost = 2
+	defaultMaxRedirects = 10
+)
+
+// maxBodyDrainBytes is how much of an unread body is discarded when it is
+// closed early, to keep the connection for the next request.
+const maxBodyDrainBytes = 256 * 1024
+
+// Client sends requests over HTTP/1.1 and keeps connections open for reuse.
+// It is safe for concurrent use.
+type Client struct {
+	dialTimeout time.Duration
+	responseHeaderTimeout time.Duration
+	timeout time.Duration
+	idleTimeout time.Duration
+	maxIdleConnsPerHost int
+	maxRedirects int
+	tlsConfig *tls.Config
+
+	mu sync.Mutex
+	idle map[string][]*conn
+}
+
+// conn is a connection to a single host, reading consecutive responses.
+type conn struct {
+	key string
+	netConn net.Conn
+	reader *response.Reader
+	idleSince time.Time
+}
+
+func New(options ...Option) *Client {
+	c := &Client{
+		dialTimeout: defaultDialTimeout,
+		idleTimeout: defaultIdleTimeout,
+		maxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		maxRedirects: defaultMaxRedirects,
+		idle: make(map[string][]*conn),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Get requests target, an absolute http or https URL.
+func (c *Client) Get(target string) (*response.Response, error) {
+	req, err := NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req and returns the response, following redirects. Redirects that
+// must not be followed, like a 307 for a streamed body, are returned as is;
+// a Location that cannot be requested is an error. The host to connect to is
+// taken from the URL of req, or from its Host header. The response body must
+// be read to the end or closed, so the connection can be reused or released.
+func (c *Client) Do(req *request.Request) (*response.Response, error) {
+	for redirects := 0; ; redirects++ {
+		resp, err := c.roundTrip(req)
+		if err != nil || c.maxRedirects == 0 {
+			return resp, err
+		}
+
+		next, err := redirectRequest(req, resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Cannot follow redirect: %w", err)
+		}
+		if next == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if redirects == c.maxRedirects {
+			return nil, fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, redirects)
+		}
+		req = next
+	}
+}
+
+// CloseIdleConnections closes all connections kept for reuse.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conns := range c.idle {
+		for _, conn := range conns {
+			conn.netConn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
+
+func (c *Client) roundTrip(req *request.Request) (*response.Response, error) {
+	target, err := endpointOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	for {
+		conn, reused, err := c.getConn(target)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.exchange(conn, req, start)
+		if err != nil {
+			conn.netConn.Close()
+			// the server may have closed an idle connection just before
+			// it was reused. It may also have processed the request before
+			// closing, so only idempotent requests without a body are sent
+			// again (RFC 9110, section 9.2.2).
+			if reused && req.Body == nil && isIdempotent(req.RequestLine.Method) && isClosedConn(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		body := &body{
+			client: c,
+			conn: conn,
+			response: resp,
+			reader: resp.Body,
+			keepAlive: resp.KeepAlive() && !req.Headers.HasToken("Connection", "close"),
+		}
+		resp.Body = body
+		if resp.DiscardBody(0) {
+			body.release(true)
+		}
+		return resp, nil
+	}
+}
+
+// exchange writes req to conn and reads the head of the response.
+func (c *Client) exchange(conn *conn, req *request.Request, start time.Time) (*response.Response, error) {
+	exchangeDeadline := deadline(start, c.timeout)
+	conn.netConn.SetDeadline(exchangeDeadline)
+	if _, err := req.WriteTo(conn.netConn); err != nil {
+		return nil, err
+	}
+
+	if c.responseHeaderTimeout > 0 {
+		headerDeadline := time.Now().Add(c.responseHeaderTimeout)
+		if exchangeDeadline.IsZero() || headerDeadline.Before(exchangeDeadline) {
+			conn.netConn.SetReadDeadline(headerDeadline)
+		}
+	}
+	method := req.RequestLine.Method
+	if method == "" {
+		method = "GET"
+	}
+	resp, err := conn.reader.ReadResponseTo(method)
+	if err != nil {
+		return nil, err
+	}
+	conn.netConn.SetReadDeadline(exchangeDeadline)
+	return resp, nil
+}
+
+// getConn returns an idle connection to target, or dials a new one.
+func (c *Client) getConn(target endpoint) (*conn, bool, error) {
+	c.mu.Lock()
+	for idle := c.idle[target.key]; len(idle) > 0; idle = c.idle[target.key] {
+		conn := idle[len(idle) - 1]
+		c.idle[target.key] = idle[:len(idle) - 1]
+		if c.idleTimeout > 0 && time.Since(conn.idleSince) > c.idleTimeout {
+			conn.netConn.Close()
+			continue
+		}
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	c.mu.Unlock()
+
+	conn, err := c.dial(target)
+	return conn, false, err
+}
+
+// putConn keeps conn for reuse, unless enough connections to its host are
+// kept already.
+func (c *Client) putConn(conn *conn) {
+	conn.netConn.SetDeadline(time.Time{})
+	conn.idleSince = time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle[conn.key]) >= c.maxIdleConnsPerHost {
+		conn.netConn.Close()
+		return
+	}
+	c.idle[conn.key] = append(c.idle[conn.key], conn)
+}
+
+func (c *Client) dial(target endpoint) (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.dialTimeout}
+
+	var netConn net.Conn
+	var err error
+	if target.useTLS {
+		config := &tls.Config{}
+		if c.tlsConfig != nil {
+			config = c.tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = target.hostname
+		}
+		netConn, err = tls.DialWithDialer(dialer, "tcp", target.address, config)
+	} else {
+		netConn, err = dialer.Dial("tcp", target.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{
+		key: target.key,
+		netConn: netConn,
+		reader: response.NewReader(netConn),
+	}, nil
+}
+
+// endpoint is where a request is sent to.
+type endpoint struct {
+	// key identifies the connections that can be shared.
+	key string
+	scheme string
+	address string
+	hostname string
+	useTLS bool
+}
+
+func endpointOf(req *request.Request) (endpoint, error) {
+	scheme, host := "http", ""
+	if req.URL != nil {
+		if req.URL.Scheme != "" {
+			scheme = req.URL.Scheme
+		}
+		host = req.URL.Host
+	}
+	if host == "" {
+		host, _ = req.Headers.Get("Host")
+	}
+	if host == "" {
+		return endpoint{}, ErrMissingHost
+	}
+
+	useTLS := scheme == "https"
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// the port is optional in URLs and the Host header.
+		hostname = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		port = "80"
+		if useTLS {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(hostname, port)
+	return endpoint{
+		key: scheme + "://" + address,
+		scheme: scheme,
+		address: address,
+		hostname: hostname,
+		useTLS: useTLS,
+	}, nil
+}
+
+// body returns the connection to the pool once the response body was read
+// to the end, and closes it if the body cannot be finished.
+type body struct {
+	client *Client
+	conn *conn
+	response *response.Response
+	reader io.ReadCloser
+	keepAlive bool
+	released bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err != nil && !b.released {
+		b.release(errors.Is(err, io.EOF))
+	}
+	return n, err
+}
+
+// Close discards a small unread rest of the body to keep the connection,
+// larger ones close it.
+func (b *body) Close() error {
+	if !b.released {
+		b.release(b.response.DiscardBody(maxBodyDrainBytes))
+	}
+	return b.reader.Close()
+}
+
+func (b *body) release(complete bool) {
+	b.released = true
+	if complete && b.keepAlive {
+		b.client.putConn(b.conn)
+		return
+	}
+	b.conn.netConn.Close()
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func isClosedConn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
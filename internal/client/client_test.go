@@ -0,0 +1,329 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/router"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+	"github.com/MrBhop/httpfromtcp/internal/server/servertest"
+)
+
+// testServer serves a few routes on localhost and records the client
+// address of every request, which shows whether connections were reused.
+type testServer struct {
+	*server.Server
+	mu sync.Mutex
+	remoteAddrs []string
+}
+
+func newTestServer(t *testing.T, options ...server.Option) *testServer {
+	ts := &testServer{}
+	r := router.New()
+	r.Handle("GET", "/hello", func(w *response.Writer, req *request.Request) {
+		server.WriteErrorResponse(w, response.StatusOK, "hello")
+	})
+	r.Handle("GET", "/chunked", func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Parts")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hel"))
+		w.WriteChunkedBody([]byte("lo"))
+		w.WriteChunkedBodyDone(false)
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Parts", "2")
+		w.WriteTrailers(trailers)
+	})
+	r.Handle("POST", "/echo", func(w *response.Writer, req *request.Request) {
+		body, _ := io.ReadAll(req.Body)
+		contentType, _ := req.Headers.Get("Content-Type")
+		server.WriteErrorResponse(w, response.StatusOK, fmt.Sprintf("%s %s", contentType, body))
+	})
+	r.Handle("GET", "/method", func(w *response.Writer, req *request.Request) {
+		server.WriteErrorResponse(w, response.StatusOK, req.RequestLine.Method)
+	})
+	r.Handle("POST", "/see-other", func(w *response.Writer, req *request.Request) {
+		redirect(w, response.StatusSeeOther, "method")
+	})
+	r.Handle("GET", "/redirect/{n}", func(w *response.Writer, req *request.Request) {
+		n := req.PathValue("n")
+		if n == "0" {
+			redirect(w, response.StatusFound, "/hello")
+			return
+		}
+		next := map[string]string{"1": "0", "2": "1"}[n]
+		redirect(w, response.StatusMovedPermanently, next)
+	})
+	r.Handle("GET", "/ftp", func(w *response.Writer, req *request.Request) {
+		redirect(w, response.StatusFound, "ftp://example.com/file")
+	})
+	r.Handle("GET", "/loop", func(w *response.Writer, req *request.Request) {
+		redirect(w, response.StatusTemporaryRedirect, "/loop")
+	})
+	r.Handle("GET", "/slow", func(w *response.Writer, req *request.Request) {
+		time.Sleep(200 * time.Millisecond)
+		server.WriteErrorResponse(w, response.StatusOK, "slow")
+	})
+
+	ts.Server = servertest.Serve(t, func(w *response.Writer, req *request.Request) {
+		ts.mu.Lock()
+		ts.remoteAddrs = append(ts.remoteAddrs, req.RemoteAddr)
+		ts.mu.Unlock()
+		r.Serve(w, req)
+	}, options...)
+	return ts
+}
+
+func (ts *testServer) url(path string) string {
+	return servertest.URL(ts.Server, path)
+}
+
+func (ts *testServer) connections() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	unique := map[string]bool{}
+	for _, addr := range ts.remoteAddrs {
+		unique[addr] = true
+	}
+	return len(unique)
+}
+
+func redirect(w *response.Writer, statusCode response.StatusCode, location string) {
+	h := response.GetDefaultHeaders(0)
+	h.Set("Location", location)
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+}
+
+func TestGet(t *testing.T) {
+	ts := newTestServer(t)
+	c := New()
+	defer c.CloseIdleConnections()
+
+	// Test: Content-Length body
+	resp, err := c.Get(ts.url("/hello"))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+
+	// Test: Chunked body with trailers
+	resp, err = c.Get(ts.url("/chunked"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+	parts, _ := resp.Trailers.Get("X-Parts")
+	assert.Equal(t, "2", parts)
+
+	// Test: Unknown routes are answered, not errors
+	resp, err = c.Get(ts.url("/missing"))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusNotFound, resp.StatusLine.StatusCode)
+	resp.Body.Close()
+
+	// all requests were sent on the same connection.
+	assert.Equal(t, 1, ts.connections())
+}
+
+func TestDo(t *testing.T) {
+	ts := newTestServer(t)
+	c := New()
+	defer c.CloseIdleConnections()
+
+	// Test: Body with a known length
+	req, err := NewRequest("POST", ts.url("/echo"), strings.NewReader("payload"))
+	require.NoError(t, err)
+	req.Headers.Set("Content-Type", "text/plain")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain payload", servertest.ReadBody(t, resp.Body))
+
+	// Test: Streamed body is chunked
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("streamed "))
+		writer.Write([]byte("payload"))
+		writer.Close()
+	}()
+	req, err = NewRequest("POST", ts.url("/echo"), reader)
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, " streamed payload", servertest.ReadBody(t, resp.Body))
+
+	// Test: Requests without a host
+	_, err = c.Do(&request.Request{Headers: headers.NewHeaders()})
+	require.ErrorIs(t, err, ErrMissingHost)
+}
+
+func TestConnectionPool(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Test: Closing an unread body keeps the connection
+	c := New()
+	for range 3 {
+		resp, err := c.Get(ts.url("/hello"))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 1, ts.connections())
+
+	// Test: Closed idle connections are replaced
+	c.CloseIdleConnections()
+	resp, err := c.Get(ts.url("/hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+	assert.Equal(t, 2, ts.connections())
+
+	// Test: Without pooling every request gets its own connection
+	c = New(WithMaxIdleConnsPerHost(0))
+	for range 2 {
+		resp, err := c.Get(ts.url("/hello"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+	}
+	assert.Equal(t, 4, ts.connections())
+
+	// Test: Requests are retried when the server closed an idle connection
+	ts = newTestServer(t, server.WithIdleTimeout(20 * time.Millisecond))
+	c = New()
+	defer c.CloseIdleConnections()
+	for range 2 {
+		resp, err := c.Get(ts.url("/hello"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, 2, ts.connections())
+
+	// Test: Other requests are not, the server may have processed them
+	ts = newTestServer(t, server.WithIdleTimeout(20 * time.Millisecond))
+	resp, err = c.Get(ts.url("/hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+	time.Sleep(100 * time.Millisecond)
+	req, err := NewRequest("POST", ts.url("/echo"), nil)
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	require.Error(t, err)
+}
+
+func TestRedirects(t *testing.T) {
+	ts := newTestServer(t)
+	c := New(WithMaxRedirects(3))
+	defer c.CloseIdleConnections()
+
+	// Test: Relative and absolute locations are followed
+	resp, err := c.Get(ts.url("/redirect/2"))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Equal(t, "hello", servertest.ReadBody(t, resp.Body))
+
+	// Test: See Other turns a POST into a GET
+	req, err := NewRequest("POST", ts.url("/see-other"), strings.NewReader("dropped"))
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", servertest.ReadBody(t, resp.Body))
+
+	// Test: Redirect loops are stopped
+	_, err = c.Get(ts.url("/loop"))
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+
+	// Test: Locations that cannot be requested are errors
+	_, err = c.Get(ts.url("/ftp"))
+	require.ErrorIs(t, err, request.ErrInvalidRequestTarget)
+
+	// Test: Following redirects can be disabled
+	resp, err = New(WithMaxRedirects(0)).Get(ts.url("/loop"))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusTemporaryRedirect, resp.StatusLine.StatusCode)
+	location, _ := resp.Headers.Get("Location")
+	assert.Equal(t, "/loop", location)
+	resp.Body.Close()
+}
+
+func TestTimeouts(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Test: Slow responses time out
+	_, err := New(WithTimeout(50 * time.Millisecond)).Get(ts.url("/slow"))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	_, err = New(WithResponseHeaderTimeout(50 * time.Millisecond)).Get(ts.url("/slow"))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// Test: Fast enough responses do not
+	resp, err := New(WithTimeout(time.Second)).Get(ts.url("/slow"))
+	require.NoError(t, err)
+	assert.Equal(t, "slow", servertest.ReadBody(t, resp.Body))
+}
+
+func TestRedirectCredentials(t *testing.T) {
+	tests := []struct {
+		location string
+		kept bool
+	}{
+		{"https://example.com/b", true},
+		{"/b", true},
+		{"http://example.com/b", false},
+		{"https://other.example.com/b", false},
+		{"https://example.com:8443/b", false},
+	}
+
+	for _, test := range tests {
+		req, err := NewRequest("GET", "https://example.com/a", nil)
+		require.NoError(t, err)
+		req.Headers.Set("Authorization", "Bearer secret")
+		req.Headers.Set("Cookie", "session=1")
+		req.Headers.Set("X-Custom", "kept")
+		resp := &response.Response{
+			StatusLine: response.StatusLine{StatusCode: response.StatusFound},
+			Headers: headers.NewHeaders(),
+		}
+		resp.Headers.Set("Location", test.location)
+
+		next, err := redirectRequest(req, resp)
+		require.NoError(t, err)
+		require.NotNil(t, next)
+		_, hasAuthorization := next.Headers.Get("Authorization")
+		_, hasCookie := next.Headers.Get("Cookie")
+		assert.Equal(t, test.kept, hasAuthorization, test.location)
+		assert.Equal(t, test.kept, hasCookie, test.location)
+		custom, _ := next.Headers.Get("X-Custom")
+		assert.Equal(t, "kept", custom, test.location)
+	}
+}
+
+func TestResolveLocation(t *testing.T) {
+	tests := []struct {
+		target string
+		location string
+		expected string
+	}{
+		{"/a/b", "https://example.com/c", "https://example.com/c"},
+		{"/a/b", "//other.com/c", "http://other.com/c"},
+		{"/a/b", "HTTPS://example.com/c", "HTTPS://example.com/c"},
+		{"/a/b", "ftp://example.com/c", "ftp://example.com/c"},
+		{"/a/b", "c:d", "c:d"},
+		{"/a/b", "./c:d", "http://localhost:8080/a/./c:d"},
+		{"/a/b?q=1", "/c", "http://localhost:8080/c"},
+		{"/a/b?q=1", "c?d=2", "http://localhost:8080/a/c?d=2"},
+		{"/a/b/", "c#fragment", "http://localhost:8080/a/b/c"},
+		{"http://localhost:8080/a/b", "c", "http://localhost:8080/a/c"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, resolveLocation("http", "localhost:8080", test.target, test.location), test.location)
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type Option func(*Client)
+
+// WithDialTimeout limits the time to establish a connection, including the
+// TLS handshake for https targets.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout limits the time to receive the status line and
+// headers once the request was written.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.responseHeaderTimeout = timeout
+	}
+}
+
+// WithTimeout limits the time of a whole exchange, from sending the request
+// to reading the end of the response body. Every redirect starts a new
+// exchange.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithIdleTimeout limits how long an unused connection is kept for reuse.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.idleTimeout = timeout
+	}
+}
+
+// WithMaxIdleConnsPerHost limits the number of unused connections kept for
+// each host. Zero disables reusing connections.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxRedirects limits the number of redirects followed for a request.
+// Zero disables following redirects, so redirect responses are returned to
+// the caller.
+func WithMaxRedirects(n int) Option {
+	return func(c *Client) {
+		c.maxRedirects = n
+	}
+}
+
+// WithTLSConfig replaces the default TLS configuration for https targets,
+// e.g. to trust a private CA.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+// redirectRequest returns the request that follows the redirect in resp, or
+// nil if resp is not a redirect that can be followed. It fails if the
+// Location cannot be requested.
+func redirectRequest(req *request.Request, resp *response.Response) (*request.Request, error) {
+	method := req.RequestLine.Method
+	switch resp.StatusLine.StatusCode {
+	case response.StatusMovedPermanently, response.StatusFound, response.StatusSeeOther:
+		// the redirect is fetched with GET, dropping the body (RFC 9110,
+		// section 15.4).
+		if method != "HEAD" {
+			method = "GET"
+		}
+	case response.StatusTemporaryRedirect, response.StatusPermanentRedirect:
+		// the method and body must not change, but a streamed body cannot
+		// be sent twice.
+		if req.Body != nil {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	location, found := resp.Headers.Get("Location")
+	if !found || location == "" {
+		return nil, nil
+	}
+	from, err := endpointOf(req)
+	if err != nil {
+		return nil, err
+	}
+	target := resolveLocation(from.scheme, hostOf(req), req.RequestLine.RequestTarget, location)
+
+	next, err := NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	// an https to http redirect to the same host would send the
+	// credentials in the clear.
+	sameOrigin := next.URL.Scheme == from.scheme && strings.EqualFold(next.URL.Host, hostOf(req))
+	for _, field := range req.Headers.Fields() {
+		switch strings.ToLower(field.Name) {
+		case "host", "content-length", "transfer-encoding", "content-type":
+			continue
+		case "authorization", "cookie":
+			// credentials are not sent to other origins.
+			if !sameOrigin {
+				continue
+			}
+		}
+		next.Headers.Add(field.Name, field.Value)
+	}
+	return next, nil
+}
+
+// resolveLocation turns the target of a Location header into an absolute
+// URL, relative to the request it redirects.
+func resolveLocation(scheme, host, requestTarget, location string) string {
+	location, _, _ = strings.Cut(location, "#")
+
+	switch {
+	case hasScheme(location):
+		return location
+	case strings.HasPrefix(location, "//"):
+		return scheme + ":" + location
+	}
+
+	origin := scheme + "://" + host
+	if strings.HasPrefix(location, "/") {
+		return origin + location
+	}
+
+	// a relative reference replaces the last segment of the path.
+	path, _, _ := strings.Cut(requestTarget, "?")
+	if i := strings.Index(path, "://"); i != -1 {
+		path = path[i + 3:]
+		if slash := strings.Index(path, "/"); slash != -1 {
+			path = path[slash:]
+		} else {
+			path = "/"
+		}
+	}
+	directory := path[:strings.LastIndex(path, "/") + 1]
+	if directory == "" {
+		directory = "/"
+	}
+	return origin + directory + location
+}
+
+// hasScheme reports whether location is an absolute URI, starting with a
+// scheme like "https:" (RFC 3986, section 3.1).
+func hasScheme(location string) bool {
+	for i := 0; i < len(location); i++ {
+		c := location[i]
+		switch {
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+		case i > 0 && (('0' <= c && c <= '9') || c == '+' || c == '-' || c == '.'):
+		case i > 0 && c == ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func hostOf(req *request.Request) string {
+	if req.URL != nil && req.URL.Host != "" {
+		return req.URL.Host
+	}
+	host, _ := req.Headers.Get("Host")
+	return host
+}
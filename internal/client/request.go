@@ -0,0 +1,57 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+)
+
+// NewRequest returns a request for an absolute http or https target, ready
+// to be sent with Do. Bodies of a known size, like a *bytes.Reader or a
+// *strings.Reader, are sent with a Content-Length, any other body chunked.
+// The method is checked when the request is written.
+func NewRequest(method, target string, body io.Reader) (*request.Request, error) {
+	url, err := request.ParseURL(target)
+	if err != nil {
+		return nil, err
+	}
+	originForm := &request.URL{
+		Form: request.TargetOriginForm,
+		Path: url.Path,
+		RawPath: url.RawPath,
+		RawQuery: url.RawQuery,
+	}
+
+	r := &request.Request{
+		RequestLine: request.RequestLine{
+			HttpVersion: "1.1",
+			RequestTarget: originForm.String(),
+			Method: method,
+		},
+		URL: url,
+		Headers: headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+	}
+	if body == nil {
+		return r, nil
+	}
+
+	switch body := body.(type) {
+	case *bytes.Reader:
+		r.Headers.Set("Content-Length", strconv.Itoa(body.Len()))
+	case *bytes.Buffer:
+		r.Headers.Set("Content-Length", strconv.Itoa(body.Len()))
+	case *strings.Reader:
+		r.Headers.Set("Content-Length", strconv.Itoa(body.Len()))
+	}
+	if readCloser, ok := body.(io.ReadCloser); ok {
+		r.Body = readCloser
+	} else {
+		r.Body = io.NopCloser(body)
+	}
+	return r, nil
+}
@@ -0,0 +1,261 @@
+package framing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/MrBhop/httpfromtcp/internal/constants"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+var ErrBodyTooLarge = errors.New("Body too large")
+
+// Error is an error in the framing of a body. Offset counts the bytes from
+// the start of the body to the element that could not be parsed, or to the
+// end of the data received if the body was cut short, in which case Err is
+// io.ErrUnexpectedEOF.
+type Error struct {
+	Offset int64
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type bodyState int
+
+const (
+	bodyStateLength bodyState = iota
+	bodyStateUntilClose
+	bodyStateChunkSize
+	bodyStateChunkData
+	bodyStateChunkDataEnd
+	bodyStateTrailers
+	bodyStateDone
+)
+
+// BodyOptions control how a chunked body is read.
+type BodyOptions struct {
+	// AllowBareLF accepts a LF without CR after chunk sizes and chunk data.
+	AllowBareLF bool
+	// MaxBytes limits the sum of the chunk sizes, zero means no limit.
+	MaxBytes int64
+	// ParseTrailer parses a trailer line like headers.Headers.Parse, which
+	// is used if it is nil. It lets the caller enforce its header limits.
+	ParseTrailer func(trailers *headers.Headers, data []byte) (int, bool, error)
+}
+
+// Body decodes a message body from a Reader, framed by a length, by chunked
+// encoding or by the end of the connection. Framing errors are returned as
+// *Error, errors of the underlying reader as they are.
+type Body struct {
+	reader *Reader
+	state bodyState
+	bytesRemaining int
+	chunkBytes int64
+	trailers *headers.Headers
+	options BodyOptions
+	offset int64
+	err error
+}
+
+// NewLengthBody returns a body of length bytes.
+func NewLengthBody(reader *Reader, length int) *Body {
+	b := &Body{
+		reader: reader,
+		state: bodyStateLength,
+		bytesRemaining: length,
+	}
+	if length == 0 {
+		b.state = bodyStateDone
+	}
+	return b
+}
+
+// NewChunkedBody returns a chunked body whose trailers are parsed into
+// trailers.
+func NewChunkedBody(reader *Reader, trailers *headers.Headers, options BodyOptions) *Body {
+	return &Body{
+		reader: reader,
+		state: bodyStateChunkSize,
+		trailers: trailers,
+		options: options,
+	}
+}
+
+// NewUntilCloseBody returns a body that ends with the connection.
+func NewUntilCloseBody(reader *Reader) *Body {
+	return &Body{
+		reader: reader,
+		state: bodyStateUntilClose,
+	}
+}
+
+// Done reports whether the body has been read to the end, including the
+// trailers of a chunked body.
+func (b *Body) Done() bool {
+	return b.state == bodyStateDone
+}
+
+// UntilClose reports whether the body ends with the connection.
+func (b *Body) UntilClose() bool {
+	return b.state == bodyStateUntilClose
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	for {
+		switch b.state {
+		case bodyStateDone:
+			return 0, io.EOF
+		case bodyStateUntilClose:
+			if len(p) == 0 {
+				return 0, nil
+			}
+			n, err := b.reader.Read(p)
+			b.offset += int64(n)
+			if n > 0 {
+				return n, nil
+			}
+			if errors.Is(err, io.EOF) {
+				b.state = bodyStateDone
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, b.fail(err)
+			}
+		case bodyStateLength, bodyStateChunkData:
+			if len(p) == 0 {
+				return 0, nil
+			}
+			n, err := b.reader.Read(p[:min(len(p), b.bytesRemaining)])
+			b.consumedData(n)
+			if n > 0 {
+				return n, nil
+			}
+			if err != nil {
+				return 0, b.fail(err)
+			}
+		default:
+			n, err := b.parseSingle(b.reader.Buffered())
+			if err != nil {
+				return 0, b.fail(&Error{Offset: b.offset, Err: err})
+			}
+			b.reader.Consume(n)
+			b.offset += int64(n)
+			if n > 0 {
+				continue
+			}
+			if bytesRead, err := b.reader.Fill(); err != nil && bytesRead == 0 {
+				return 0, b.fail(err)
+			}
+		}
+	}
+}
+
+// Discard reads and drops up to limit bytes of the unread body. It reports
+// whether the end of the body was reached.
+func (b *Body) Discard(limit int) bool {
+	buffer := make([]byte, min(limit, 32 * 1024))
+	for discarded := 0; discarded < limit; {
+		n, err := b.Read(buffer[:min(len(buffer), limit - discarded)])
+		discarded += n
+		if err != nil {
+			return errors.Is(err, io.EOF)
+		}
+	}
+	return b.Done()
+}
+
+// parseSingle parses the chunked framing around the chunk data.
+func (b *Body) parseSingle(next []byte) (int, error) {
+	switch b.state {
+	case bodyStateChunkSize:
+		n, chunkSize, err := ParseChunkSizeLine(next, b.options.AllowBareLF)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			if len(next) > MaxChunkSizeLineBytes {
+				return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+			}
+			return 0, nil
+		}
+		b.bytesRemaining = chunkSize
+		b.chunkBytes += int64(chunkSize)
+		if b.options.MaxBytes > 0 && b.chunkBytes > b.options.MaxBytes {
+			return 0, ErrBodyTooLarge
+		}
+		if chunkSize == 0 {
+			b.state = bodyStateTrailers
+		} else {
+			b.state = bodyStateChunkData
+		}
+		return n, nil
+	case bodyStateChunkDataEnd:
+		if b.options.AllowBareLF && len(next) > 0 && next[0] == '\n' {
+			b.state = bodyStateChunkSize
+			return 1, nil
+		}
+		if len(next) < len(constants.CrLf) {
+			return 0, nil
+		}
+		if string(next[:len(constants.CrLf)]) != constants.CrLf {
+			return 0, fmt.Errorf("%w: chunk data is not terminated by crlf", ErrMalformedChunk)
+		}
+		b.state = bodyStateChunkSize
+		return len(constants.CrLf), nil
+	case bodyStateTrailers:
+		parseTrailer := b.options.ParseTrailer
+		if parseTrailer == nil {
+			parseTrailer = (*headers.Headers).Parse
+		}
+		n, done, err := parseTrailer(b.trailers, next)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			b.state = bodyStateDone
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("Unknown state")
+	}
+}
+
+// consumedData advances the body after n bytes of data were read.
+func (b *Body) consumedData(n int) {
+	b.offset += int64(n)
+	b.bytesRemaining -= n
+	if b.bytesRemaining > 0 {
+		return
+	}
+	switch b.state {
+	case bodyStateLength:
+		b.state = bodyStateDone
+	case bodyStateChunkData:
+		b.state = bodyStateChunkDataEnd
+	}
+}
+
+// fail records err, reporting the end of the connection as a body cut short
+// at the end of the data received.
+func (b *Body) fail(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = &Error{
+			Offset: b.offset + int64(len(b.reader.Buffered())),
+			Err: io.ErrUnexpectedEOF,
+		}
+	}
+	b.err = err
+	return err
+}
@@ -0,0 +1,83 @@
+package framing
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+func TestBody(t *testing.T) {
+	// Test: Length bodies stop at their length and keep the rest buffered
+	reader := NewReader(iotest.OneByteReader(strings.NewReader("helloNEXT")))
+	body := NewLengthBody(reader, 5)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.True(t, body.Done())
+	require.NoError(t, reader.WaitForData())
+	assert.Equal(t, "N", string(reader.Buffered()))
+
+	// Test: Chunked bodies parse the chunks and trailers
+	trailers := headers.NewHeaders()
+	reader = NewReader(iotest.OneByteReader(strings.NewReader("5;ext\r\nhello\r\n6\r\n world\r\n0\r\nX-Sum: 42\r\n\r\n")))
+	body = NewChunkedBody(reader, trailers, BodyOptions{})
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	value, _ := trailers.Get("X-Sum")
+	assert.Equal(t, "42", value)
+
+	// Test: Bare LF is only accepted if allowed
+	body = NewChunkedBody(NewReader(strings.NewReader("5\nhello\n0\n\n")), headers.NewHeaders(), BodyOptions{})
+	_, err = io.ReadAll(body)
+	require.ErrorIs(t, err, headers.ErrBareLF)
+
+	body = NewChunkedBody(NewReader(strings.NewReader("5\nhello\n0\n\n")), headers.NewHeaders(), BodyOptions{
+		AllowBareLF: true,
+		ParseTrailer: func(h *headers.Headers, data []byte) (int, bool, error) {
+			return h.ParseWithOptions(data, headers.ParseOptions{AllowBareLF: true})
+		},
+	})
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Test: Framing errors carry the offset of the element in the body
+	body = NewChunkedBody(NewReader(strings.NewReader("5\r\nhelloX\r\n")), headers.NewHeaders(), BodyOptions{})
+	_, err = io.ReadAll(body)
+	var framingErr *Error
+	require.ErrorAs(t, err, &framingErr)
+	require.ErrorIs(t, err, ErrMalformedChunk)
+	assert.Equal(t, int64(8), framingErr.Offset)
+
+	// Test: The chunk sizes are limited
+	body = NewChunkedBody(NewReader(strings.NewReader("5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n")), headers.NewHeaders(), BodyOptions{MaxBytes: 8})
+	_, err = io.ReadAll(body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Bodies cut short are reported at the end of the data received
+	body = NewLengthBody(NewReader(strings.NewReader("hel")), 5)
+	_, err = io.ReadAll(body)
+	require.ErrorAs(t, err, &framingErr)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, int64(3), framingErr.Offset)
+
+	// Test: Bodies without framing end with the connection
+	body = NewUntilCloseBody(NewReader(strings.NewReader("until the end")))
+	assert.True(t, body.UntilClose())
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", string(data))
+	assert.True(t, body.Done())
+
+	// Test: Discard reports whether the end was reached
+	body = NewLengthBody(NewReader(strings.NewReader("0123456789")), 10)
+	assert.False(t, body.Discard(4))
+	assert.True(t, body.Discard(6))
+}
@@ -0,0 +1,104 @@
+package framing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+// Errors for message bodies whose framing cannot be read. Requests and
+// responses are framed the same way, so both parsers share them.
+var (
+	ErrMalformedChunk = errors.New("Malformed chunked body")
+	ErrDuplicateContentLength = errors.New("Multiple Content-Length values")
+	ErrInvalidContentLength = errors.New("Invalid Content-Length")
+)
+
+// chunk-size lines only carry a number and optional extensions, so they get
+// a fixed limit instead of a configurable one.
+const MaxChunkSizeLineBytes = 4 * 1024
+
+// chunk sizes are limited to what fits into an int on every platform.
+const maxChunkSizeDigits = 7
+
+// ParseChunkSizeLine parses a line of the form
+// chunk-size [ chunk-ext ] CRLF
+// Chunk extensions are validated, but otherwise ignored. It returns the
+// number of bytes consumed, which is 0 if data does not contain a complete
+// line yet, and the chunk size.
+func ParseChunkSizeLine(data []byte, allowBareLF bool) (int, int, error) {
+	lineBytes, n, err := headers.FindLine(data, allowBareLF)
+	if err != nil || n == 0 {
+		return 0, 0, err
+	}
+
+	line := string(lineBytes)
+	sizeString, extensions, _ := strings.Cut(line, ";")
+	sizeString = strings.TrimRight(sizeString, " \t")
+
+	if sizeString == "" {
+		return 0, 0, fmt.Errorf("%w: chunk size '%s'", ErrMalformedChunk, sizeString)
+	}
+	for _, r := range sizeString {
+		if !isHexDigit(r) {
+			return 0, 0, fmt.Errorf("%w: chunk size '%s'", ErrMalformedChunk, sizeString)
+		}
+	}
+	// leading zeros are allowed and do not count towards the digits.
+	if len(strings.TrimLeft(sizeString, "0")) > maxChunkSizeDigits {
+		return 0, 0, fmt.Errorf("%w: chunk size '%s'", ErrMalformedChunk, sizeString)
+	}
+	chunkSize, err := strconv.ParseInt(sizeString, 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: chunk size: %w", ErrMalformedChunk, err)
+	}
+
+	if err := validateChunkExtensions(extensions); err != nil {
+		return 0, 0, err
+	}
+
+	return n, int(chunkSize), nil
+}
+
+// ParseContentLength parses the values of all Content-Length fields. Exactly
+// one value consisting only of digits is accepted. Leading zeros are
+// rejected as well, since not every parser reads them the same way.
+func ParseContentLength(values []string) (int, error) {
+	if len(values) > 1 || strings.Contains(values[0], ",") {
+		return 0, ErrDuplicateContentLength
+	}
+
+	value := values[0]
+	if value == "" || (len(value) > 1 && value[0] == '0') {
+		return 0, fmt.Errorf("%w: '%s'", ErrInvalidContentLength, value)
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return 0, fmt.Errorf("%w: '%s'", ErrInvalidContentLength, value)
+		}
+	}
+	contentLength, err := strconv.ParseInt(value, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%w: '%s'", ErrInvalidContentLength, value)
+	}
+	return int(contentLength), nil
+}
+
+func validateChunkExtensions(extensions string) error {
+	for _, r := range extensions {
+		if r == '\t' {
+			continue
+		}
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("%w: invalid character %q in chunk extension", ErrMalformedChunk, r)
+		}
+	}
+	return nil
+}
+
+func isHexDigit(r rune) bool {
+	return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+}
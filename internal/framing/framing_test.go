@@ -0,0 +1,74 @@
+package framing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChunkSizeLine(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		n int
+		size int
+		err error
+	}{
+		{"size", "1a\r\ndata", 4, 26, nil},
+		{"extension", "5;name=value\r\n", 14, 5, nil},
+		{"whitespace before extension", "5 \t;name\r\n", 10, 5, nil},
+		{"incomplete line", "5", 0, 0, nil},
+		{"empty size", "\r\n", 0, 0, ErrMalformedChunk},
+		{"not hex", "5g\r\n", 0, 0, ErrMalformedChunk},
+		{"sign", "+5\r\n", 0, 0, ErrMalformedChunk},
+		{"too many digits", "12345678\r\n", 0, 0, ErrMalformedChunk},
+		{"zero padded", "00000010\r\n", 10, 16, nil},
+		{"zero padded last chunk", "00000000\r\n", 10, 0, nil},
+		{"too many digits after zeros", "0012345678\r\n", 0, 0, ErrMalformedChunk},
+		{"control character in extension", "5;a\x00\r\n", 0, 0, ErrMalformedChunk},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, size, err := ParseChunkSizeLine([]byte(test.data), false)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.n, n)
+			assert.Equal(t, test.size, size)
+		})
+	}
+}
+
+func TestParseContentLength(t *testing.T) {
+	tests := []struct {
+		name string
+		values []string
+		length int
+		err error
+	}{
+		{"zero", []string{"0"}, 0, nil},
+		{"length", []string{"1234"}, 1234, nil},
+		{"repeated field", []string{"5", "5"}, 0, ErrDuplicateContentLength},
+		{"list", []string{"5, 5"}, 0, ErrDuplicateContentLength},
+		{"empty", []string{""}, 0, ErrInvalidContentLength},
+		{"leading zero", []string{"05"}, 0, ErrInvalidContentLength},
+		{"sign", []string{"+5"}, 0, ErrInvalidContentLength},
+		{"overflow", []string{"99999999999999999999"}, 0, ErrInvalidContentLength},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			length, err := ParseContentLength(test.values)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.length, length)
+		})
+	}
+}
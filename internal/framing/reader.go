@@ -0,0 +1,71 @@
+package framing
+
+import (
+	"io"
+
+	"github.com/MrBhop/httpfromtcp/internal/constants"
+)
+
+// Reader buffers a connection for a message parser. The parser looks at the
+// buffered data, consumes the elements it could parse and keeps the rest, so
+// bytes read past the end of one message are there for the next one.
+type Reader struct {
+	reader io.Reader
+	buffer []byte
+	usedBufferLength int
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buffer: make([]byte, constants.BufferLength),
+	}
+}
+
+// Buffered returns the data that was read but not consumed yet.
+func (r *Reader) Buffered() []byte {
+	return r.buffer[:r.usedBufferLength]
+}
+
+// Consume drops the first n buffered bytes.
+func (r *Reader) Consume(n int) {
+	copy(r.buffer, r.buffer[n:r.usedBufferLength])
+	r.usedBufferLength -= n
+}
+
+// Fill reads more data from the underlying reader into the buffer, growing
+// the buffer if it is full.
+func (r *Reader) Fill() (int, error) {
+	if capacity := len(r.buffer); r.usedBufferLength >= capacity {
+		newBuffer := make([]byte, capacity * 2)
+		copy(newBuffer, r.buffer)
+		r.buffer = newBuffer
+	}
+
+	bytesRead, err := r.reader.Read(r.buffer[r.usedBufferLength:])
+	r.usedBufferLength += bytesRead
+	return bytesRead, err
+}
+
+// WaitForData blocks until at least one byte is buffered. io.EOF is returned
+// if the reader is exhausted first.
+func (r *Reader) WaitForData() error {
+	for r.usedBufferLength == 0 {
+		bytesRead, err := r.Fill()
+		if err != nil && bytesRead == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read copies buffered data into p. Once the buffer is empty, data is read
+// straight from the underlying reader to avoid copying large bodies twice.
+func (r *Reader) Read(p []byte) (int, error) {
+	if buffered := r.Buffered(); len(buffered) > 0 {
+		n := copy(p, buffered)
+		r.Consume(n)
+		return n, nil
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,62 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parseSection parses data until the end of the field section, an error, or
+// the end of data. It returns the number of bytes consumed.
+func parseSection(h *Headers, data []byte, options ParseOptions) (int, bool, error) {
+	consumed := 0
+	for {
+		n, done, err := h.ParseWithOptions(data[consumed:], options)
+		if err != nil {
+			return consumed, false, err
+		}
+		consumed += n
+		if done || n == 0 {
+			return consumed, done, nil
+		}
+	}
+}
+
+func FuzzHeadersParse(f *testing.F) {
+	f.Add([]byte("Host: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"), false, false)
+	f.Add([]byte("Set-Cookie: a=1; Path=/\r\nSet-Cookie: b=2\r\nCache-Control: no-cache\r\ncache-control: max-age=0\r\n\r\n"), false, false)
+	f.Add([]byte("X-Folded: a\r\n\t b\r\n\r\n"), true, false)
+	f.Add([]byte("Host: localhost\nAccept: text/html,  application/json \n\n"), false, true)
+	f.Add([]byte("Host localhost\r\n\r\n"), false, false)
+
+	f.Fuzz(func(t *testing.T, data []byte, allowObsFold, allowBareLF bool) {
+		options := ParseOptions{AllowObsFold: allowObsFold, AllowBareLF: allowBareLF}
+		h := NewHeaders()
+		consumed, done, err := parseSection(h, data, options)
+		require.LessOrEqual(t, consumed, len(data))
+		if err != nil || !done {
+			return
+		}
+
+		for _, field := range h.Fields() {
+			require.NoError(t, validateHeaderKey(field.Name))
+			require.Equal(t, strings.Trim(field.Value, " \t"), field.Value)
+			require.False(t, strings.ContainsAny(field.Value, "\r\n\x00"))
+		}
+
+		// writing the fields out again gives the same fields in strict mode.
+		var serialized strings.Builder
+		for _, field := range h.Fields() {
+			serialized.WriteString(field.Name + ": " + field.Value + "\r\n")
+		}
+		serialized.WriteString("\r\n")
+
+		again := NewHeaders()
+		consumed, done, err = parseSection(again, []byte(serialized.String()), ParseOptions{})
+		require.NoError(t, err, "%q", serialized.String())
+		require.True(t, done)
+		require.Equal(t, serialized.Len(), consumed)
+		require.Equal(t, h.Fields(), again.Fields())
+	})
+}
@@ -2,112 +2,327 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
-	"unicode"
+)
 
-	"github.com/MrBhop/httpfromtcp/internal/constants"
+var (
+	ErrInvalidHeaderName = errors.New("Invalid header field name")
+	ErrInvalidHeaderValue = errors.New("Invalid header field value")
+	ErrMalformedHeaderLine = errors.New("Malformed header field line")
+	ErrObsFold = errors.New("Obsolete line folding is not allowed")
+	ErrBareLF = errors.New("Bare LF line endings are not allowed")
+	// ErrWhitespaceBeforeColon rejects field lines like "Transfer-Encoding : chunked",
+	// which some parsers ignore and others accept, so they cannot agree on how the
+	// message is framed (RFC 9112, section 5.1).
+	ErrWhitespaceBeforeColon = errors.New("Whitespace between field name and colon is not allowed")
+	// ErrWhitespaceBeforeFieldName rejects a first field line starting with
+	// whitespace. Some parsers take it for a field, others ignore it or fold
+	// it into the start line (RFC 9112, section 2.2).
+	ErrWhitespaceBeforeFieldName = errors.New("Whitespace before the first field name is not allowed")
 )
 
-type Headers map[string]string
+// Field is a single header field line. Name keeps the casing it was added
+// with, so headers are written out the way they were received or set.
+type Field struct {
+	Name string
+	Value string
+}
+
+// Headers holds header fields in the order they were added. Lookups are
+// case-insensitive. Repeated fields are kept as separate lines, Get joins
+// their values with ", " except for Set-Cookie, which must never be joined.
+type Headers struct {
+	fields []Field
+}
+
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+// Get returns the value of the field with the given name. Values of repeated
+// fields are joined with ", ". Set-Cookie values cannot be combined that way,
+// so only the first one is returned for it; use Values to get all of them.
+func (h *Headers) Get(key string) (string, bool) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	if isSetCookie(key) {
+		return values[0], true
+	}
+	return strings.Join(values, ", "), true
+}
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	val, exists := h[key]
-	return val, exists
+// Values returns the values of all fields with the given name, in order.
+func (h *Headers) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+	var values []string
+	for _, field := range h.fields {
+		if EqualFold(field.Name, key) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+// Add appends a field, keeping the ones already present with the same name.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, Field{Name: key, Value: value})
+}
+
+// Set replaces all fields with the given name by a single one, which takes
+// the place of the first field replaced.
+func (h *Headers) Set(key, value string) {
+	for i, field := range h.fields {
+		if EqualFold(field.Name, key) {
+			h.fields[i] = Field{Name: key, Value: value}
+			h.removeFrom(i+1, key)
+			return
+		}
+	}
+	h.Add(key, value)
 }
 
-func (h Headers) Add(key, value string) {
-	key = strings.ToLower(key)
-	if _, exists := h[key]; exists {
-		h[key] += ", " + value
+func (h *Headers) Remove(key string) {
+	if h == nil {
 		return
 	}
-	h[key] = value
+	h.removeFrom(0, key)
+}
+
+func (h *Headers) removeFrom(start int, key string) {
+	kept := h.fields[:start]
+	for _, field := range h.fields[start:] {
+		if !EqualFold(field.Name, key) {
+			kept = append(kept, field)
+		}
+	}
+	clear(h.fields[len(kept):])
+	h.fields = kept
+}
+
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// Fields returns a copy of the field lines in order.
+func (h *Headers) Fields() []Field {
+	if h == nil {
+		return nil
+	}
+	return slices.Clone(h.fields)
+}
+
+// HasToken reports whether the comma separated lists stored under key contain
+// token, compared case-insensitively.
+func (h *Headers) HasToken(key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, element := range strings.Split(value, ",") {
+			if EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanonicalName returns name with the first letter and every letter after a
+// hyphen in upper case and all other letters in lower case, so
+// "content-type" becomes "Content-Type".
+func CanonicalName(name string) string {
+	canonical := []byte(name)
+	upper := true
+	for i, c := range canonical {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			canonical[i] = c - 'a' + 'A'
+		case !upper && 'A' <= c && c <= 'Z':
+			canonical[i] = c - 'A' + 'a'
+		}
+		upper = c == '-'
+	}
+	return string(canonical)
+}
+
+// ValidateField checks that a field can be written without changing the
+// meaning of the message, which rules out names that are not tokens and
+// values containing line breaks or other control characters.
+func ValidateField(name, value string) error {
+	if err := validateHeaderKey(name); err != nil {
+		return err
+	}
+	if _, err := parseFieldValue(value); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+func isSetCookie(key string) bool {
+	return EqualFold(key, "Set-Cookie")
 }
 
-func (h Headers) Remove(key string) {
-	key = strings.ToLower(key)
-	delete(h, key)
+// ParseOptions controls how strictly Parse follows RFC 9112.
+type ParseOptions struct {
+	// AllowObsFold accepts obsolete line folding, a field line continued on
+	// the next line starting with whitespace, and replaces the fold with a
+	// single space. It is rejected otherwise.
+	AllowObsFold bool
+	// AllowBareLF accepts a bare LF as line ending in addition to CRLF.
+	AllowBareLF bool
 }
 
-func NewHeaders() Headers {
-	return Headers{}
+// Parse parses a single field line from data, rejecting obsolete line
+// folding. It returns the number of bytes consumed, which is 0 if data does
+// not contain a complete line yet, and whether the empty line ending the
+// field section was reached.
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	return h.ParseWithOptions(data, ParseOptions{})
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	n = strings.Index(string(data), constants.CrLf)
-	switch n {
-	case -1:
-		return 0, false, nil
-	case 0:
-		return 2, true, nil
+// ParseWithOptions is like Parse, using the given options.
+func (h *Headers) ParseWithOptions(data []byte, options ParseOptions) (n int, done bool, err error) {
+	lineBytes, n, err := FindLine(data, options.AllowBareLF)
+	if err != nil || n == 0 {
+		return 0, false, err
+	}
+	if len(lineBytes) == 0 {
+		return n, true, nil
 	}
 
-	line := data[:n]
-	parts := bytes.SplitN(line, []byte(":"), 2)
+	line := string(lineBytes)
+	if isWhitespace(line[0]) {
+		if h.Len() == 0 {
+			return 0, false, ErrWhitespaceBeforeFieldName
+		}
+		if !options.AllowObsFold {
+			return 0, false, ErrObsFold
+		}
+		continuation, err := parseFieldValue(line)
+		if err != nil {
+			return 0, false, err
+		}
+		last := &h.fields[len(h.fields)-1]
+		if continuation != "" {
+			if last.Value != "" {
+				last.Value += " "
+			}
+			last.Value += continuation
+		}
+		return n, false, nil
+	}
 
-	key := string(parts[0])
-	if key != strings.TrimRight(key, " ") {
-		return 0, false, fmt.Errorf("Whitespace after the key is not allowed.")
+	key, value, found := strings.Cut(line, ":")
+	if !found {
+		return 0, false, fmt.Errorf("%w: missing colon", ErrMalformedHeaderLine)
+	}
+	if key != strings.TrimRight(key, " \t") {
+		return 0, false, ErrWhitespaceBeforeColon
 	}
 
-	key = strings.TrimSpace(key)
 	if err := validateHeaderKey(key); err != nil {
 		return 0, false, err
 	}
 
-	fieldValue := strings.TrimSpace(string(parts[1]))
-	if len(strings.Split(fieldValue, " ")) > 1 {
-		return 0, false, fmt.Errorf("Whitespace in the field value is not allowed.")
+	fieldValue, err := parseFieldValue(value)
+	if err != nil {
+		return 0, false, err
 	}
 
 	h.Add(key, fieldValue)
-	return n + 2, false, nil
+	return n, false, nil
+}
+
+// FindLine returns the first line in data without its line ending, and the
+// number of bytes up to and including the line ending, which is 0 if data
+// does not contain a complete line yet. Lines end with CRLF, a bare LF is
+// only accepted if allowBareLF is set.
+func FindLine(data []byte, allowBareLF bool) (line []byte, n int, err error) {
+	i := bytes.IndexByte(data, '\n')
+	if i == -1 {
+		return nil, 0, nil
+	}
+	if i > 0 && data[i-1] == '\r' {
+		return data[:i-1], i + 1, nil
+	}
+	if !allowBareLF {
+		return nil, 0, ErrBareLF
+	}
+	return data[:i], i + 1, nil
+}
+
+// parseFieldValue trims the optional whitespace around a field value and
+// rejects control characters other than horizontal tab, which includes bare
+// CR and LF. Internal whitespace and obs-text are allowed (RFC 9110, section
+// 5.5).
+func parseFieldValue(value string) (string, error) {
+	value = strings.Trim(value, " \t")
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return "", fmt.Errorf("%w: invalid character %q", ErrInvalidHeaderValue, c)
+		}
+	}
+	return value, nil
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t'
 }
 
 func validateHeaderKey(key string) error {
 	if len(key) < 1 {
-		return fmt.Errorf("Invalid key length")
-	}
-
-	specialChars := map[rune]struct{}{
-		'!': {},
-		'#': {},
-		'$': {},
-		'%': {},
-		'&': {},
-		'\'': {},
-		'*': {},
-		'+': {},
-		'-': {},
-		'.': {},
-		'^': {},
-		'_': {},
-		'`': {},
-		'|': {},
-		'~': {},
-	}
-	for _, r := range key {
-		if unicode.IsLetter(r) {
-			continue
-		}
+		return fmt.Errorf("%w: empty name", ErrInvalidHeaderName)
+	}
 
-		if unicode.IsDigit(r) {
-			continue
+	// names are ASCII tokens. Other letters would be accepted by some
+	// parsers and folded into framing fields like Transfer-Encoding by
+	// others.
+	for i := 0; i < len(key); i++ {
+		if !IsTchar(key[i]) {
+			return fmt.Errorf("%w: invalid character %q", ErrInvalidHeaderName, key[i])
 		}
+	}
 
-		if _, exists := specialChars[r]; exists {
-			continue
-		}
+	return nil
+}
 
-		return fmt.Errorf("Invalid character, '%c'", r)
+// IsTchar reports whether c may appear in a token (RFC 9110, section 5.6.2),
+// like a field name or a method.
+func IsTchar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
 	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
 
-	return nil
+// EqualFold reports whether a and b are equal, ignoring the case of ASCII
+// letters only. Field names and tokens are ASCII, and strings.EqualFold
+// would match them with letters like 'ſ' (U+017F), which folds to 's'.
+func EqualFold(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if toLower(a[i]) != toLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+	return c
 }
@@ -6,6 +6,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func fieldValue(h *Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 func TestHeaders(t *testing.T) {
 	// Test: Valid single header
 	headers := NewHeaders()
@@ -13,20 +18,29 @@ func TestHeaders(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "localhost:42069", headers["host"])
+	require.Equal(t, "localhost:42069", fieldValue(headers, "host"))
 	require.Equal(t, 23, n)
 	require.False(t, done)
 
 	// Test: Valid single header with extra whitespace
 	headers = NewHeaders()
-	data = []byte("   Host:   localhost:42069   \r\n\r\n")
+	data = []byte("Host:   localhost:42069   \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "localhost:42069", headers["host"])
-	require.Equal(t, 31, n)
+	require.Equal(t, "localhost:42069", fieldValue(headers, "host"))
+	require.Equal(t, 28, n)
 	require.False(t, done)
 
+	// Test: Invalid whitespace before the first field name
+	for _, line := range []string{"   Host: localhost:42069\r\n\r\n", "\tContent-Length: 3\r\n\r\n"} {
+		headers = NewHeaders()
+		n, done, err = headers.ParseWithOptions([]byte(line), ParseOptions{AllowObsFold: true})
+		require.ErrorIs(t, err, ErrWhitespaceBeforeFieldName)
+		require.Equal(t, 0, n)
+		require.False(t, done)
+	}
+
 	// Test: Invalid spacing header
 	headers = NewHeaders()
 	data = []byte("       Host : localhost:42069       \r\n\r\n")
@@ -37,18 +51,18 @@ func TestHeaders(t *testing.T) {
 
 	// Test: Valid 2 headers
 	headers = NewHeaders()
-	data = []byte("Host:localhost:42069\r\n Content-Type: Application/Json  \r\n")
+	data = []byte("Host:localhost:42069\r\nContent-Type: Application/Json  \r\n")
 	n, done, err = headers.Parse(data)
 	require.Nil(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "localhost:42069", headers["host"])
+	require.Equal(t, "localhost:42069", fieldValue(headers, "host"))
 	require.Equal(t, 22, n)
 	require.False(t, done)
 	n, done, err = headers.Parse(data[n:])
 	require.Nil(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "Application/Json", headers["content-type"])
-	require.Equal(t, 35, n)
+	require.Equal(t, "Application/Json", fieldValue(headers, "content-type"))
+	require.Equal(t, 34, n)
 	require.False(t, done)
 
 	// Test: Valid done
@@ -61,10 +75,39 @@ func TestHeaders(t *testing.T) {
 	require.True(t, done)
 
 
-	// Test: Invalid header value, containing space
+	// Test: Valid header value, containing internal whitespace
 	headers = NewHeaders()
-	data = []byte("Host: localhost with a space\r\n\r\n")
+	data = []byte("User-Agent: Mozilla/5.0 (X11; Linux x86_64)\r\n\r\n")
 	n, done, err = headers.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", fieldValue(headers, "user-agent"))
+	require.Equal(t, 45, n)
+	require.False(t, done)
+
+	// Test: Only optional whitespace is trimmed
+	headers = NewHeaders()
+	data = []byte("Accept:\t text/html,  application/json \t\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, "text/html,  application/json", fieldValue(headers, "accept"))
+
+	// Test: Invalid header value, containing control characters
+	for _, value := range []string{"a\x00b", "a\rb", "a\nb", "a\x1bb", "a\x7fb"} {
+		headers = NewHeaders()
+		n, done, err = headers.Parse([]byte("X-Value: " + value + "\r\n\r\n"))
+		require.Error(t, err, "%q", value)
+		require.Equal(t, 0, n)
+		require.False(t, done)
+	}
+
+	// Test: obs-text is allowed in values
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Name: caf\xc3\xa9\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	n, done, err = headers.Parse([]byte("Host localhost\r\n\r\n"))
 	require.Error(t, err)
 	require.Equal(t, 0, n)
 	require.False(t, done)
@@ -77,15 +120,137 @@ func TestHeaders(t *testing.T) {
 	require.Equal(t, 0, n)
 	require.False(t, done)
 
+	// Test: Non-ASCII letters and digits in header key
+	for _, name := range []string{"Tran\u017ffer-Encoding", "Cont\u0435nt-Length", "X-\u0661"} {
+		headers = NewHeaders()
+		_, _, err = headers.Parse([]byte(name + ": chunked\r\n"))
+		require.ErrorIs(t, err, ErrInvalidHeaderName, name)
+	}
+
+	// Test: Names only match ignoring ASCII case
+	headers = NewHeaders()
+	headers.Add("transfer-ENCODING", "chunked")
+	require.True(t, headers.HasToken("Transfer-Encoding", "CHUNKED"))
+	require.Empty(t, headers.Values("Tran\u017ffer-Encoding"))
+	require.False(t, headers.HasToken("Transfer-Encoding", "chun\u212aed"))
+
 	// Test: Valid single header with existing value
 	headers = NewHeaders()
-	headers["host"] = "localhost:42070"
+	headers.Set("Host", "localhost:42070")
 	data = []byte("Host: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	require.Equal(t, "localhost:42070, localhost:42069", headers["host"])
+	require.Equal(t, "localhost:42070, localhost:42069", fieldValue(headers, "host"))
 	require.Equal(t, 23, n)
 	require.False(t, done)
 
 }
+
+func TestObsFold(t *testing.T) {
+	data := []byte("X-Folded: first\r\n \t second\r\n\r\n")
+
+	// Test: Rejected by default
+	headers := NewHeaders()
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.Error(t, err)
+
+	// Test: Replaced with a space when allowed
+	options := ParseOptions{AllowObsFold: true}
+	headers = NewHeaders()
+	n, _, err = headers.ParseWithOptions(data, options)
+	require.NoError(t, err)
+	m, done, err := headers.ParseWithOptions(data[n:], options)
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, 11, m)
+	require.Equal(t, "first second", fieldValue(headers, "X-Folded"))
+	require.Equal(t, 1, headers.Len())
+
+	// Test: Folded values are validated too
+	headers = NewHeaders()
+	_, _, err = headers.ParseWithOptions([]byte("X-Folded: first\r\n"), options)
+	require.NoError(t, err)
+	_, _, err = headers.ParseWithOptions([]byte(" bad\x00\r\n"), options)
+	require.Error(t, err)
+}
+
+func TestHasToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Connection", "keep-alive, Upgrade")
+	require.True(t, headers.HasToken("connection", "upgrade"))
+	require.True(t, headers.HasToken("Connection", "Keep-Alive"))
+	require.False(t, headers.HasToken("Connection", "close"))
+	require.False(t, headers.HasToken("Transfer-Encoding", "chunked"))
+}
+
+func TestHeaderOrder(t *testing.T) {
+	// Test: Insertion order and original casing are kept
+	headers := NewHeaders()
+	headers.Add("Content-Type", "text/html")
+	headers.Add("X-Request-ID", "abc")
+	headers.Add("cache-control", "no-cache")
+	require.Equal(t, []Field{
+		{Name: "Content-Type", Value: "text/html"},
+		{Name: "X-Request-ID", Value: "abc"},
+		{Name: "cache-control", Value: "no-cache"},
+	}, headers.Fields())
+
+	// Test: Lookup is case-insensitive
+	value, exists := headers.Get("x-request-id")
+	require.True(t, exists)
+	require.Equal(t, "abc", value)
+
+	// Test: Repeated fields are kept as separate lines
+	headers.Add("Cache-Control", "max-age=0")
+	require.Equal(t, 4, headers.Len())
+	require.Equal(t, []string{"no-cache", "max-age=0"}, headers.Values("Cache-Control"))
+	require.Equal(t, "no-cache, max-age=0", fieldValue(headers, "Cache-Control"))
+
+	// Test: Set replaces all repeated fields in place of the first one
+	headers.Set("Cache-Control", "no-store")
+	require.Equal(t, []Field{
+		{Name: "Content-Type", Value: "text/html"},
+		{Name: "X-Request-ID", Value: "abc"},
+		{Name: "Cache-Control", Value: "no-store"},
+	}, headers.Fields())
+
+	// Test: Remove
+	headers.Remove("content-type")
+	_, exists = headers.Get("Content-Type")
+	require.False(t, exists)
+	require.Equal(t, 2, headers.Len())
+
+	// Test: Set-Cookie values are never joined
+	headers = NewHeaders()
+	headers.Add("Set-Cookie", "session=abc; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	headers.Add("Set-Cookie", "theme=dark")
+	require.Equal(t, []string{"session=abc; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "theme=dark"}, headers.Values("set-cookie"))
+	require.Equal(t, "session=abc; Expires=Wed, 21 Oct 2015 07:28:00 GMT", fieldValue(headers, "Set-Cookie"))
+
+	// Test: Parsed fields keep their casing and order
+	headers = NewHeaders()
+	data := []byte("X-B: 2\r\nx-a: 1\r\nX-B: 3\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	require.Equal(t, []Field{
+		{Name: "X-B", Value: "2"},
+		{Name: "x-a", Value: "1"},
+		{Name: "X-B", Value: "3"},
+	}, headers.Fields())
+}
+
+func TestCanonicalName(t *testing.T) {
+	require.Equal(t, "Content-Type", CanonicalName("content-type"))
+	require.Equal(t, "X-Forwarded-For", CanonicalName("X-FORWARDED-FOR"))
+	require.Equal(t, "Www-Authenticate", CanonicalName("WWW-Authenticate"))
+	require.Equal(t, "X-1a", CanonicalName("x-1A"))
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/accesslog"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// Recover turns a panicking handler into a 500 response written by
+// server.DefaultErrorHandler. The server recovers panics as well, but only
+// after all middlewares, so this lets the middlewares wrapping Recover see the
+// 500. If the response was already started, the connection is closed instead.
+func Recover() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				log.Printf("Panic in handler for %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, recovered, debug.Stack())
+
+				w.CloseAfterResponse()
+				if w.State() == response.WriterStatusLine {
+					server.DefaultErrorHandler(w, response.StatusInternalServerError, fmt.Errorf("Handler panicked: %v", recovered))
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// RequestID makes sure every request carries an X-Request-Id header, keeping
+// the one sent by the client and generating one otherwise. The ID is echoed
+// in the response headers.
+func RequestID() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, exists := req.Headers.Get(RequestIDHeader)
+			if !exists || id == "" {
+				id = newRequestID()
+				req.Headers.Set(RequestIDHeader, id)
+			}
+			w.AddHeader(RequestIDHeader, id)
+			next(w, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Timing reports the time each request took to handle to record, e.g. to
+// feed metrics.
+func Timing(record func(req *request.Request, statusCode response.StatusCode, duration time.Duration)) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			defer func() {
+				record(req, w.StatusCode(), time.Since(start))
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// AccessLog writes an entry to logger for every request once the handler
+// returns. Unlike server.WithAccessLog, it only sees requests that reach the
+// handler, so it can log a subset of the routes or log them separately.
+func AccessLog(logger *accesslog.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			defer func() {
+				if err := logger.Log(server.AccessLogEntry(start, req, w)); err != nil {
+					log.Printf("Error writing access log: %s\n", err)
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/accesslog"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+	"github.com/MrBhop/httpfromtcp/internal/server/servertest"
+)
+
+// roundTrip serves a single request with handler and returns the response
+// and its body.
+func roundTrip(t *testing.T, handler server.Handler, raw string) (*response.Response, string) {
+	conn := servertest.Dial(t, servertest.Serve(t, handler))
+	_, err := io.WriteString(conn, raw)
+	require.NoError(t, err)
+	resp, err := response.NewReader(conn).ReadResponse()
+	require.NoError(t, err)
+	return resp, servertest.ReadBody(t, resp.Body)
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name string
+		middlewares []string
+		want string
+	}{
+		{"no middleware", nil, "handler"},
+		{"single", []string{"a"}, "a> handler <a"},
+		{"first is outermost", []string{"a", "b", "c"}, "a> b> c> handler <c <b <a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			middlewares := []server.Middleware{}
+			for _, name := range test.middlewares {
+				middlewares = append(middlewares, func(next server.Handler) server.Handler {
+					return func(w *response.Writer, req *request.Request) {
+						calls = append(calls, name + ">")
+						next(w, req)
+						calls = append(calls, "<" + name)
+					}
+				})
+			}
+			handler := server.Chain(func(w *response.Writer, req *request.Request) {
+				calls = append(calls, "handler")
+				server.WriteErrorResponse(w, response.StatusOK, "ok")
+			}, middlewares...)
+
+			// the middlewares return after the response was sent.
+			done := make(chan struct{})
+			resp, body := roundTrip(t, func(w *response.Writer, req *request.Request) {
+				defer close(done)
+				handler(w, req)
+			}, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+			assert.Equal(t, "ok", body)
+			<-done
+			assert.Equal(t, test.want, strings.Join(calls, " "))
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		header string
+		want string
+	}{
+		{"kept", "X-Request-Id: abc123\r\n", "abc123"},
+		{"generated when missing", "", ""},
+		{"generated when empty", "X-Request-Id:\r\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := server.Chain(func(w *response.Writer, req *request.Request) {
+				id, _ := req.Headers.Get(RequestIDHeader)
+				server.WriteErrorResponse(w, response.StatusOK, id)
+			}, RequestID())
+
+			resp, seen := roundTrip(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\n" + test.header + "\r\n")
+			echoed, _ := resp.Headers.Get(RequestIDHeader)
+			assert.Equal(t, seen, echoed)
+			if test.want != "" {
+				assert.Equal(t, test.want, seen)
+			} else {
+				assert.Len(t, seen, 32)
+			}
+		})
+	}
+}
+
+func TestTiming(t *testing.T) {
+	tests := []struct {
+		name string
+		statusCode response.StatusCode
+		delay time.Duration
+	}{
+		{"ok", response.StatusOK, 0},
+		{"not found", response.StatusNotFound, 0},
+		{"slow", response.StatusOK, 20 * time.Millisecond},
+	}
+
+	type record struct {
+		target string
+		statusCode response.StatusCode
+		duration time.Duration
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the response can arrive before the record is made.
+			records := make(chan record, 1)
+			handler := server.Chain(func(w *response.Writer, req *request.Request) {
+				time.Sleep(test.delay)
+				server.WriteErrorResponse(w, test.statusCode, "")
+			}, Timing(func(req *request.Request, statusCode response.StatusCode, duration time.Duration) {
+				records <- record{req.RequestLine.RequestTarget, statusCode, duration}
+			}))
+
+			resp, _ := roundTrip(t, handler, "GET /timed HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			assert.Equal(t, test.statusCode, resp.StatusLine.StatusCode)
+
+			r := <-records
+			assert.Equal(t, "/timed", r.target)
+			assert.Equal(t, test.statusCode, r.statusCode)
+			assert.GreaterOrEqual(t, r.duration, test.delay)
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name string
+		handler server.Handler
+		statusCode response.StatusCode
+		body string
+	}{
+		{"no panic", func(w *response.Writer, req *request.Request) {
+			server.WriteErrorResponse(w, response.StatusOK, "ok")
+		}, response.StatusOK, "ok"},
+		{"panic", func(w *response.Writer, req *request.Request) {
+			panic("boom")
+		}, response.StatusInternalServerError, "Internal Server Error"},
+		{"panic with error", func(w *response.Writer, req *request.Request) {
+			var m map[string]int
+			m["boom"]++
+		}, response.StatusInternalServerError, "Internal Server Error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Test: Middlewares outside of Recover see the 500
+			statusCodes := make(chan response.StatusCode, 1)
+			handler := server.Chain(test.handler, Timing(func(req *request.Request, statusCode response.StatusCode, duration time.Duration) {
+				statusCodes <- statusCode
+			}), Recover())
+
+			resp, body := roundTrip(t, handler, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			assert.Equal(t, test.statusCode, resp.StatusLine.StatusCode)
+			assert.Equal(t, test.body, body)
+			assert.Equal(t, test.statusCode, <-statusCodes)
+			assert.Equal(t, test.statusCode == response.StatusOK, resp.KeepAlive())
+		})
+	}
+}
+
+// lineWriter passes every write to the test, as log entries are written
+// after the response was sent.
+type lineWriter chan string
+
+func (l lineWriter) Write(p []byte) (int, error) {
+	l <- string(p)
+	return len(p), nil
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name string
+		raw string
+		statusCode response.StatusCode
+		userAgent string
+	}{
+		{"ok", "GET /logged?a=b HTTP/1.1\r\nHost: localhost\r\nUser-Agent: test/1.0\r\n\r\n", response.StatusOK, "test/1.0"},
+		{"not found", "GET /logged?a=b HTTP/1.0\r\n\r\n", response.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := make(lineWriter, 1)
+			handler := server.Chain(func(w *response.Writer, req *request.Request) {
+				server.WriteErrorResponse(w, test.statusCode, "logged")
+			}, AccessLog(accesslog.New(lines, accesslog.FormatJSON)))
+
+			resp, _ := roundTrip(t, handler, test.raw)
+			assert.Equal(t, test.statusCode, resp.StatusLine.StatusCode)
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal([]byte(<-lines), &entry))
+			assert.Equal(t, "GET", entry["method"])
+			assert.Equal(t, "/logged?a=b", entry["target"])
+			assert.Equal(t, float64(test.statusCode), entry["status"])
+			assert.Equal(t, test.userAgent, entry["user_agent"])
+			assert.NotEmpty(t, entry["remote_addr"])
+			assert.Equal(t, float64(len("logged")), entry["bytes"])
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/client"
+)
+
+func (p *ReverseProxy) runHealthChecks() {
+	checker := client.New(
+		client.WithMaxRedirects(0),
+		client.WithTimeout(p.healthCheckInterval),
+		client.WithMaxIdleConnsPerHost(0),
+	)
+
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.checkHealth(checker)
+		}
+	}
+}
+
+// checkHealth requests the health check path from every upstream. Any status
+// below 500 counts as healthy, so a check path that redirects or needs
+// authentication still shows the upstream is up.
+func (p *ReverseProxy) checkHealth(checker *client.Client) {
+	for _, u := range p.upstreams {
+		target := u.url.Scheme + "://" + u.url.Host + strings.TrimSuffix(u.url.RawPath, "/") + p.healthCheckPath
+		resp, err := checker.Get(target)
+		healthy := err == nil && resp.StatusLine.StatusCode < 500
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		if wasHealthy := u.healthy.Swap(healthy); wasHealthy != healthy {
+			state := "healthy"
+			if !healthy {
+				state = "unhealthy"
+			}
+			log.Printf("Upstream %s is %s", u.url.Host, state)
+		}
+	}
+}
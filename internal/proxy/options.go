@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/client"
+)
+
+type Option func(*ReverseProxy)
+
+// WithClient replaces the client used to reach the upstreams. The client
+// should not follow redirects, so they are relayed to the client instead.
+func WithClient(c *client.Client) Option {
+	return func(p *ReverseProxy) {
+		p.client = c
+	}
+}
+
+// WithStripPrefix removes prefix from the path of every request before it is
+// forwarded, e.g. to serve an upstream below "/api". Only whole segments are
+// removed, so "/api" does not apply to "/apiary".
+func WithStripPrefix(prefix string) Option {
+	return func(p *ReverseProxy) {
+		p.stripPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithHealthCheck requests path from every upstream each interval. Upstreams
+// answering with an error status, or not at all, get no requests until they
+// pass a check again.
+func WithHealthCheck(path string, interval time.Duration) Option {
+	return func(p *ReverseProxy) {
+		p.healthCheckPath = path
+		p.healthCheckInterval = interval
+	}
+}
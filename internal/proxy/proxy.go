@@ -0,0 +1,338 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/client"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+)
+
+var ErrNoUpstreams = errors.New("Reverse proxy needs at least one upstream")
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultResponseHeaderTimeout = time.Minute
+)
+
+// copyBufferSize is the largest piece of a body relayed at once.
+const copyBufferSize = 32 * 1024
+
+// hopByHopHeaders only apply to a single connection, so they are not
+// forwarded (RFC 9110, section 7.6.1). Fields listed in Connection are
+// removed as well.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReverseProxy forwards requests to a set of upstream servers, taking turns
+// among the healthy ones, and relays their responses.
+type ReverseProxy struct {
+	upstreams []*upstream
+	next atomic.Uint64
+	client *client.Client
+	stripPrefix string
+	healthCheckPath string
+	healthCheckInterval time.Duration
+	stop chan struct{}
+	stopOnce sync.Once
+}
+
+type upstream struct {
+	url *request.URL
+	healthy atomic.Bool
+}
+
+// New returns a reverse proxy for the upstreams, given as absolute http or
+// https URLs. A path in the URL is put in front of every forwarded path.
+func New(upstreams []string, options ...Option) (*ReverseProxy, error) {
+	if len(upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	p := &ReverseProxy{
+		client: client.New(
+			client.WithMaxRedirects(0),
+			client.WithDialTimeout(defaultDialTimeout),
+			client.WithResponseHeaderTimeout(defaultResponseHeaderTimeout),
+		),
+		stop: make(chan struct{}),
+	}
+	for _, target := range upstreams {
+		url, err := request.ParseURL(target)
+		if err != nil {
+			return nil, fmt.Errorf("upstream '%s': %w", target, err)
+		}
+		u := &upstream{url: url}
+		u.healthy.Store(true)
+		p.upstreams = append(p.upstreams, u)
+	}
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.healthCheckPath != "" && p.healthCheckInterval > 0 {
+		go p.runHealthChecks()
+	}
+	return p, nil
+}
+
+// Close stops the health checks.
+func (p *ReverseProxy) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Serve is a server.Handler forwarding the request to the next healthy
+// upstream. The request and response bodies are streamed, not buffered.
+func (p *ReverseProxy) Serve(w *response.Writer, req *request.Request) {
+	u := p.pick()
+	if u == nil {
+		statusCode := response.StatusServiceUnavailable
+		server.WriteErrorResponse(w, statusCode, response.StatusText(statusCode))
+		return
+	}
+
+	resp, err := p.client.Do(p.outgoingRequest(u, req))
+	if err != nil {
+		log.Printf("Error forwarding %s %s to %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, u.url.Host, err)
+		statusCode := response.StatusBadGateway
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			statusCode = response.StatusGatewayTimeout
+		}
+		// the request body may be partly read, so the connection cannot be
+		// reused.
+		w.CloseAfterResponse()
+		server.WriteErrorResponse(w, statusCode, response.StatusText(statusCode))
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := relayResponse(w, req.RequestLine.Method, resp); err != nil {
+		log.Printf("Error relaying response from %s: %v", u.url.Host, err)
+	}
+}
+
+// pick returns the next healthy upstream in turn, or nil if there is none.
+func (p *ReverseProxy) pick() *upstream {
+	start := p.next.Add(1) - 1
+	for i := range uint64(len(p.upstreams)) {
+		u := p.upstreams[(start + i) % uint64(len(p.upstreams))]
+		if u.healthy.Load() {
+			return u
+		}
+	}
+	return nil
+}
+
+// outgoingRequest builds the request sent to u. The target is built from the
+// normalized path, the one the router matched, so "/api/../admin" cannot
+// reach past the prefix. The body is only forwarded if the request announced
+// one.
+func (p *ReverseProxy) outgoingRequest(u *upstream, req *request.Request) *request.Request {
+	path := req.URL.Path
+	if p.stripPrefix != "" {
+		if path == p.stripPrefix {
+			path = "/"
+		} else if rest, found := strings.CutPrefix(path, p.stripPrefix + "/"); found {
+			path = "/" + rest
+		}
+	}
+	target := &request.URL{
+		Form: request.TargetOriginForm,
+		Path: strings.TrimSuffix(u.url.Path, "/") + path,
+		RawQuery: req.URL.RawQuery,
+	}
+
+	h := headers.NewHeaders()
+	for _, field := range withoutHopByHop(req.Headers) {
+		if !strings.EqualFold(field.Name, "Host") {
+			h.Add(field.Name, field.Value)
+		}
+	}
+	h.Set("Host", u.url.Host)
+	addForwardedHeaders(h, req)
+
+	out := &request.Request{
+		RequestLine: request.RequestLine{
+			HttpVersion: "1.1",
+			RequestTarget: target.String(),
+			Method: req.RequestLine.Method,
+		},
+		URL: &request.URL{
+			Form: request.TargetAbsoluteForm,
+			Scheme: u.url.Scheme,
+			Host: u.url.Host,
+			Path: target.Path,
+			RawQuery: target.RawQuery,
+		},
+		Headers: h,
+		// the trailers are filled in once the body is read to the end.
+		Trailers: req.Trailers,
+	}
+	_, hasLength := req.Headers.Get("Content-Length")
+	_, hasTransferEncoding := req.Headers.Get("Transfer-Encoding")
+	if hasLength || hasTransferEncoding {
+		out.Body = req.Body
+	}
+	return out
+}
+
+// addForwardedHeaders tells the upstream about the client and the request
+// it sent, extending the values set by proxies in front of this one.
+func addForwardedHeaders(h *headers.Headers, req *request.Request) {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		clientIP = req.RemoteAddr
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	host, _ := req.Headers.Get("Host")
+
+	if clientIP != "" {
+		forwardedFor := clientIP
+		if prior, exists := h.Get("X-Forwarded-For"); exists {
+			forwardedFor = prior + ", " + clientIP
+		}
+		h.Set("X-Forwarded-For", forwardedFor)
+	}
+	if host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+	h.Set("X-Forwarded-Proto", proto)
+
+	// Forwarded (RFC 7239) carries the same information in one field.
+	var element []string
+	if clientIP != "" {
+		forwardedIP := clientIP
+		if strings.Contains(clientIP, ":") {
+			forwardedIP = "[" + clientIP + "]"
+		}
+		element = append(element, "for=" + forwardedValue(forwardedIP))
+	}
+	if host != "" {
+		element = append(element, "host=" + forwardedValue(host))
+	}
+	element = append(element, "proto=" + proto)
+	h.Add("Forwarded", strings.Join(element, ";"))
+}
+
+// forwardedValue quotes values of a Forwarded element that are not tokens,
+// like addresses with a port.
+func forwardedValue(value string) string {
+	if strings.ContainsAny(value, ":[]\"") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+// relayResponse writes resp to w. Bodies of known length keep their
+// Content-Length, all others are streamed chunked with their trailers.
+// Responses that cannot have a body keep their headers as they are.
+func relayResponse(w *response.Writer, method string, resp *response.Response) error {
+	h := headers.NewHeaders()
+	for _, field := range withoutHopByHop(resp.Headers) {
+		h.Add(field.Name, field.Value)
+	}
+	statusCode := resp.StatusLine.StatusCode
+	hasBody := method != "HEAD" && statusCode != response.StatusNoContent && statusCode != response.StatusNotModified
+	_, hasLength := h.Get("Content-Length")
+	_, hasTransferEncoding := resp.Headers.Get("Transfer-Encoding")
+	chunked := hasBody && (!hasLength || hasTransferEncoding)
+	if chunked {
+		h.Remove("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+	}
+
+	if err := w.WriteStatusLineWithReason(resp.StatusLine.StatusCode, resp.StatusLine.ReasonPhrase); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	if !hasBody {
+		return nil
+	}
+
+	buffer := make([]byte, copyBufferSize)
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			write := w.WriteBody
+			if chunked {
+				write = w.WriteChunkedBody
+			}
+			if _, err := write(buffer[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the client cannot be told anymore, the incomplete body makes
+			// the server close the connection.
+			w.CloseAfterResponse()
+			return err
+		}
+	}
+	if !chunked {
+		return nil
+	}
+
+	if err := w.WriteChunkedBodyDone(false); err != nil {
+		return err
+	}
+	trailers := headers.NewHeaders()
+	for _, field := range withoutHopByHop(resp.Trailers) {
+		trailers.Add(field.Name, field.Value)
+	}
+	return w.WriteTrailers(trailers)
+}
+
+// withoutHopByHop returns the fields of h that are meant for the next
+// message, not for the connection they arrived on.
+func withoutHopByHop(h *headers.Headers) []headers.Field {
+	drop := append([]string{}, hopByHopHeaders...)
+	for _, value := range h.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			drop = append(drop, strings.TrimSpace(token))
+		}
+	}
+
+	var fields []headers.Field
+	for _, field := range h.Fields() {
+		isHopByHop := false
+		for _, name := range drop {
+			if strings.EqualFold(field.Name, name) {
+				isHopByHop = true
+				break
+			}
+		}
+		if !isHopByHop {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/client"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+	"github.com/MrBhop/httpfromtcp/internal/server/servertest"
+)
+
+// serve runs handler on a local server and returns its URL.
+func serve(t *testing.T, handler server.Handler) string {
+	return servertest.URL(servertest.Serve(t, handler), "")
+}
+
+// newProxy serves a reverse proxy for upstreams and returns its URL.
+func newProxy(t *testing.T, upstreams []string, options ...Option) (*ReverseProxy, string) {
+	p, err := New(upstreams, options...)
+	require.NoError(t, err)
+	t.Cleanup(p.Close)
+	return p, serve(t, p.Serve)
+}
+
+func field(h *headers.Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
+// echo answers with the request as the upstream received it.
+func echo(w *response.Writer, req *request.Request) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s %s\n", req.RequestLine.Method, req.RequestLine.RequestTarget)
+	for _, field := range req.Headers.Fields() {
+		fmt.Fprintf(&out, "%s: %s\n", field.Name, field.Value)
+	}
+	body, _ := io.ReadAll(req.Body)
+	fmt.Fprintf(&out, "\n%s", body)
+	for _, field := range req.Trailers.Fields() {
+		fmt.Fprintf(&out, "\n%s: %s", field.Name, field.Value)
+	}
+	server.WriteErrorResponse(w, response.StatusOK, out.String())
+}
+
+func TestForwardRequest(t *testing.T) {
+	upstream := serve(t, echo)
+	_, proxyURL := newProxy(t, []string{upstream + "/base"}, WithStripPrefix("/api"))
+	c := client.New()
+	defer c.CloseIdleConnections()
+
+	// Test: Method, target, headers and body are forwarded
+	req, err := client.NewRequest("PUT", proxyURL + "/api/items/1?verbose=true", strings.NewReader("payload"))
+	require.NoError(t, err)
+	req.Headers.Add("X-Custom", "kept")
+	req.Headers.Add("X-Forwarded-For", "203.0.113.7")
+	req.Headers.Add("Connection", "X-Hop")
+	req.Headers.Add("X-Hop", "dropped")
+	req.Headers.Add("Keep-Alive", "timeout=5")
+	req.Headers.Add("Proxy-Authorization", "Basic c2VjcmV0")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	received := servertest.ReadBody(t, resp.Body)
+
+	head, body, _ := strings.Cut(received, "\n\n")
+	lines := strings.Split(head, "\n")
+	assert.Equal(t, "PUT /base/items/1?verbose=true", lines[0])
+	assert.Contains(t, lines, "Host: " + strings.TrimPrefix(upstream, "http://"))
+	assert.Contains(t, lines, "X-Custom: kept")
+	assert.Contains(t, lines, "X-Forwarded-For: 203.0.113.7, 127.0.0.1")
+	assert.Contains(t, lines, "X-Forwarded-Host: " + strings.TrimPrefix(proxyURL, "http://"))
+	assert.Contains(t, lines, "X-Forwarded-Proto: http")
+	assert.Contains(t, lines, fmt.Sprintf(`Forwarded: for=127.0.0.1;host="%s";proto=http`, strings.TrimPrefix(proxyURL, "http://")))
+	assert.Equal(t, "payload", body)
+	for _, line := range lines {
+		assert.NotContains(t, line, "X-Hop")
+		assert.NotContains(t, line, "Keep-Alive")
+		assert.NotContains(t, line, "Proxy-Authorization")
+	}
+
+	// Test: The normalized path is forwarded, the prefix is only stripped
+	// from whole segments
+	targets := map[string]string{
+		"/api/../api/x": "/base/x",
+		"//api/x": "/base/x",
+		"/api/a%20b": "/base/a%20b",
+		"/api": "/base/",
+		"/apiary": "/base/apiary",
+		"/other/../api/x?q=1": "/base/x?q=1",
+	}
+	for target, forwarded := range targets {
+		req, err := client.NewRequest("GET", proxyURL + target, nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		lines := strings.Split(servertest.ReadBody(t, resp.Body), "\n")
+		assert.Equal(t, "GET " + forwarded, lines[0], target)
+	}
+
+	// Test: Chunked bodies are forwarded with their trailers
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("streamed"))
+		writer.Close()
+	}()
+	req, err = client.NewRequest("POST", proxyURL + "/api/upload", reader)
+	require.NoError(t, err)
+	req.Trailers.Add("X-Checksum", "abc")
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	_, body, _ = strings.Cut(servertest.ReadBody(t, resp.Body), "\n\n")
+	assert.Equal(t, "streamed\nX-Checksum: abc", body)
+}
+
+func TestRelayResponse(t *testing.T) {
+	release := make(chan struct{})
+	upstream := serve(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/created":
+			h := response.GetDefaultHeaders(2)
+			h.Add("Set-Cookie", "a=1")
+			h.Add("Set-Cookie", "b=2")
+			h.Add("Keep-Alive", "timeout=5")
+			w.WriteStatusLineWithReason(response.StatusCreated, "Made It")
+			w.WriteHeaders(h)
+			w.WriteBody([]byte("ok"))
+		case "/stream":
+			h := headers.NewHeaders()
+			h.Set("Transfer-Encoding", "chunked")
+			h.Set("Trailer", "X-Parts")
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(h)
+			w.WriteChunkedBody([]byte("first"))
+			// the rest is only sent once the client got the first chunk.
+			<-release
+			w.WriteChunkedBody([]byte(" second"))
+			w.WriteChunkedBodyDone(false)
+			trailers := headers.NewHeaders()
+			trailers.Set("X-Parts", "2")
+			w.WriteTrailers(trailers)
+		case "/empty":
+			w.WriteStatusLine(response.StatusNoContent)
+			w.WriteHeaders(headers.NewHeaders())
+		default:
+			server.WriteErrorResponse(w, response.StatusNotFound, "missing upstream")
+		}
+	})
+	_, proxyURL := newProxy(t, []string{upstream})
+	c := client.New()
+	defer c.CloseIdleConnections()
+
+	// Test: Status, reason phrase and headers are relayed
+	resp, err := c.Get(proxyURL + "/created")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusLine{HttpVersion: "1.1", StatusCode: response.StatusCreated, ReasonPhrase: "Made It"}, resp.StatusLine)
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.Headers.Values("Set-Cookie"))
+	assert.Equal(t, "2", field(resp.Headers, "Content-Length"))
+	_, found := resp.Headers.Get("Keep-Alive")
+	assert.False(t, found)
+	assert.Equal(t, "ok", servertest.ReadBody(t, resp.Body))
+
+	// Test: Error statuses are relayed, not replaced
+	resp, err = c.Get(proxyURL + "/missing")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusNotFound, resp.StatusLine.StatusCode)
+	assert.Equal(t, "missing upstream", servertest.ReadBody(t, resp.Body))
+
+	// Test: Chunked bodies are streamed with their trailers
+	resp, err = c.Get(proxyURL + "/stream")
+	require.NoError(t, err)
+	assert.Equal(t, "chunked", field(resp.Headers, "Transfer-Encoding"))
+	first := make([]byte, len("first"))
+	_, err = io.ReadFull(resp.Body, first)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(first))
+	close(release)
+	assert.Equal(t, " second", servertest.ReadBody(t, resp.Body))
+	assert.Equal(t, "2", field(resp.Trailers, "X-Parts"))
+
+	// Test: Responses without a body
+	resp, err = c.Get(proxyURL + "/empty")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusNoContent, resp.StatusLine.StatusCode)
+	assert.Equal(t, "", servertest.ReadBody(t, resp.Body))
+}
+
+func TestUpstreams(t *testing.T) {
+	named := func(name string, healthStatus *response.StatusCode) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.RequestLine.RequestTarget == "/health" {
+				server.WriteErrorResponse(w, *healthStatus, "")
+				return
+			}
+			server.WriteErrorResponse(w, response.StatusOK, name)
+		}
+	}
+	healthA, healthB := response.StatusOK, response.StatusOK
+	upstreamA := serve(t, named("a", &healthA))
+	upstreamB := serve(t, named("b", &healthB))
+	p, proxyURL := newProxy(t, []string{upstreamA, upstreamB}, WithHealthCheck("/health", 0))
+	c := client.New()
+	defer c.CloseIdleConnections()
+
+	get := func() (response.StatusCode, string) {
+		resp, err := c.Get(proxyURL + "/")
+		require.NoError(t, err)
+		return resp.StatusLine.StatusCode, servertest.ReadBody(t, resp.Body)
+	}
+	answers := func(n int) []string {
+		var names []string
+		for range n {
+			_, name := get()
+			names = append(names, name)
+		}
+		return names
+	}
+
+	// Test: Requests take turns among the upstreams
+	assert.Equal(t, []string{"a", "b", "a", "b"}, answers(4))
+
+	// Test: Unhealthy upstreams are skipped until they recover
+	checker := client.New()
+	healthB = response.StatusInternalServerError
+	p.checkHealth(checker)
+	assert.Equal(t, []string{"a", "a", "a"}, answers(3))
+
+	healthB = response.StatusOK
+	p.checkHealth(checker)
+	assert.ElementsMatch(t, []string{"a", "b"}, answers(2))
+
+	// Test: Without a healthy upstream the proxy is unavailable
+	healthA, healthB = response.StatusInternalServerError, response.StatusServiceUnavailable
+	p.checkHealth(checker)
+	statusCode, _ := get()
+	assert.Equal(t, response.StatusServiceUnavailable, statusCode)
+}
+
+func TestUnreachableUpstream(t *testing.T) {
+	s, err := server.Serve(0, echo)
+	require.NoError(t, err)
+	_, port, _ := net.SplitHostPort(s.Addr().String())
+	s.Close()
+	upstream := "http://127.0.0.1:" + port
+
+	_, proxyURL := newProxy(t, []string{upstream})
+	resp, err := client.New().Get(proxyURL + "/")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadGateway, resp.StatusLine.StatusCode)
+	resp.Body.Close()
+
+	_, err = New(nil)
+	require.ErrorIs(t, err, ErrNoUpstreams)
+	_, err = New([]string{"ftp://example.com"})
+	require.ErrorIs(t, err, request.ErrInvalidRequestTarget)
+}
@@ -0,0 +1,79 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+)
+
+var ErrBodyClosed = errors.New("Read on closed request body")
+
+// body is the Request.Body handed to handlers. Framing errors are reported
+// as ParseErrors with their offset in the request.
+type body struct {
+	request *Request
+	framed *framing.Body
+	err error
+	closed bool
+}
+
+func newBody(reader *framing.Reader, request *Request) *body {
+	b := &body{request: request}
+	if request.chunked {
+		b.framed = framing.NewChunkedBody(reader, request.Trailers, framing.BodyOptions{
+			AllowBareLF: request.options.AllowBareLF,
+			MaxBytes: request.limits.MaxBodyBytes,
+			ParseTrailer: request.parseHeaderLine,
+		})
+	} else {
+		b.framed = framing.NewLengthBody(reader, request.contentLength)
+	}
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.framed.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = b.request.bodyError(err)
+		return n, b.err
+	}
+	return n, err
+}
+
+// Close stops the handler from reading any further. Unread data is dropped
+// by the server before the next request on the connection is read.
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// bodyError turns a framing error into a ParseError at its offset in the
+// request. Errors of the connection, like timeouts, are returned as is.
+func (r *Request) bodyError(err error) error {
+	var framingErr *framing.Error
+	if !errors.As(err, &framingErr) {
+		return err
+	}
+
+	kind := framingErr.Err
+	switch {
+	case errors.Is(kind, io.ErrUnexpectedEOF):
+		kind = fmt.Errorf("%w: %w", ErrIncompleteRequest, io.ErrUnexpectedEOF)
+	case errors.Is(kind, framing.ErrBodyTooLarge):
+		kind = ErrBodyTooLarge
+	}
+	return &ParseError{
+		Offset: r.offset + framingErr.Offset,
+		HttpVersion: r.RequestLine.HttpVersion,
+		Err: kind,
+	}
+}
@@ -0,0 +1,96 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+var (
+	ErrMalformedRequestLine = errors.New("Malformed request line")
+	ErrUnsupportedVersion = errors.New("Unsupported HTTP version")
+	ErrInvalidRequestTarget = errors.New("Invalid request target")
+	ErrMalformedChunk = framing.ErrMalformedChunk
+	ErrIncompleteRequest = errors.New("Request ended prematurely")
+)
+
+// Errors of the header parser, available here so callers only need to check
+// for errors of this package.
+var (
+	ErrInvalidHeaderName = headers.ErrInvalidHeaderName
+	ErrInvalidHeaderValue = headers.ErrInvalidHeaderValue
+	ErrMalformedHeaderLine = headers.ErrMalformedHeaderLine
+)
+
+// errorKinds lists the errors a ParseError can wrap, with the status code a
+// server should answer them with. Kinds not listed here are answered with
+// 400 Bad Request.
+var errorKinds = []struct {
+	err error
+	statusCode int
+}{
+	{ErrMalformedRequestLine, 400},
+	{ErrUnsupportedVersion, 505},
+	{ErrInvalidRequestTarget, 400},
+	{ErrRequestLineTooLong, 414},
+	{ErrInvalidHeaderName, 400},
+	{ErrInvalidHeaderValue, 400},
+	{ErrMalformedHeaderLine, 400},
+	{headers.ErrObsFold, 400},
+	{headers.ErrBareLF, 400},
+	{headers.ErrWhitespaceBeforeColon, 400},
+	{headers.ErrWhitespaceBeforeFieldName, 400},
+	{ErrHeaderTooLarge, 431},
+	{ErrTooManyHeaders, 431},
+	{ErrDuplicateContentLength, 400},
+	{ErrInvalidContentLength, 400},
+	{ErrContentLengthWithTransferEncoding, 400},
+	{ErrUnsupportedTransferEncoding, 501},
+	{ErrMalformedChunk, 400},
+	{ErrBodyTooLarge, 413},
+	{ErrIncompleteRequest, 400},
+}
+
+// ParseError is returned when a request cannot be parsed. It wraps one of the
+// Err variables of this package, which identifies the problem, together with
+// details that are meant for logs rather than for the client.
+type ParseError struct {
+	// Offset is the position of the offending element, counted in bytes
+	// from the start of the request line.
+	Offset int64
+	// HttpVersion is the version of the request line, or "" if the error
+	// occurred before it was parsed.
+	HttpVersion string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s (at byte %d)", e.Err, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the Err variable the error wraps, whose message is safe to
+// show to clients, or nil if it wraps none of them.
+func (e *ParseError) Kind() error {
+	for _, kind := range errorKinds {
+		if errors.Is(e.Err, kind.err) {
+			return kind.err
+		}
+	}
+	return nil
+}
+
+// StatusCode returns the status code to answer the request with.
+func (e *ParseError) StatusCode() int {
+	for _, kind := range errorKinds {
+		if errors.Is(e.Err, kind.err) {
+			return kind.statusCode
+		}
+	}
+	return 400
+}
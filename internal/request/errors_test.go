@@ -0,0 +1,97 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		kind error
+		statusCode int
+		offset int64
+	}{
+		{"malformed request line", "GET /\r\n\r\n", ErrMalformedRequestLine, 400, 0},
+		{"invalid method", "G(T / HTTP/1.1\r\n\r\n", ErrMalformedRequestLine, 400, 0},
+		{"unsupported version", "GET / HTTP/2.0\r\n\r\n", ErrUnsupportedVersion, 505, 0},
+		{"invalid target", "GET /../etc/passwd HTTP/1.1\r\n\r\n", ErrInvalidRequestTarget, 400, 0},
+		{"invalid header name", "GET / HTTP/1.1\r\nHost: a\r\nBad@Name: b\r\n\r\n", ErrInvalidHeaderName, 400, 25},
+		{"invalid header value", "GET / HTTP/1.1\r\nX-Value: a\x00b\r\n\r\n", ErrInvalidHeaderValue, 400, 16},
+		{"missing colon", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", ErrMalformedHeaderLine, 400, 16},
+		{"whitespace before first field", "GET / HTTP/1.1\r\n Host: localhost\r\n\r\n", headers.ErrWhitespaceBeforeFieldName, 400, 16},
+		{"unsupported transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", ErrUnsupportedTransferEncoding, 501, 42},
+		{"incomplete head", "GET / HTTP/1.1\r\nHost: local", ErrIncompleteRequest, 400, 27},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{
+				data: test.data,
+				numBytesPerRead: 3,
+			})
+			var parseErr *ParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.ErrorIs(t, err, test.kind)
+			assert.Equal(t, test.kind, parseErr.Kind())
+			assert.Equal(t, test.statusCode, parseErr.StatusCode())
+			assert.Equal(t, test.offset, parseErr.Offset)
+		})
+	}
+
+	// Test: Limits map to their status codes
+	reader := NewReader(&chunkReader{
+		data: "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	reader.SetLimits(Limits{MaxHeaderCount: 1})
+	_, err := reader.ReadRequest()
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, ErrTooManyHeaders, parseErr.Kind())
+	assert.Equal(t, 431, parseErr.StatusCode())
+	assert.Equal(t, int64(22), parseErr.Offset)
+
+	// Test: Errors while reading the body carry their offset too
+	r, err := RequestFromReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloX\r\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, ErrMalformedChunk, parseErr.Kind())
+	assert.Equal(t, int64(55), parseErr.Offset)
+
+	// Test: A body cut short is an incomplete request
+	r, err = RequestFromReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nhello",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, ErrIncompleteRequest, parseErr.Kind())
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assert.Equal(t, int64(44), parseErr.Offset)
+
+	// Test: The version is known once the request line was parsed
+	_, err = RequestFromReader(&chunkReader{
+		data: "GET / HTTP/1.0\r\nBad@Name: a\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "1.0", parseErr.HttpVersion)
+	_, err = RequestFromReader(&chunkReader{
+		data: "GET / HTTP/2.0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "", parseErr.HttpVersion)
+}
@@ -0,0 +1,31 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+// Errors for requests whose body framing is ambiguous. Intermediaries may
+// disagree on where such a request ends, which allows smuggling a second
+// request inside its body, so they are rejected instead of guessed at.
+var (
+	ErrDuplicateContentLength = framing.ErrDuplicateContentLength
+	ErrInvalidContentLength = framing.ErrInvalidContentLength
+	ErrContentLengthWithTransferEncoding = errors.New("Both Content-Length and Transfer-Encoding are present")
+	ErrUnsupportedTransferEncoding = errors.New("Unsupported Transfer-Encoding")
+)
+
+// validateTransferEncoding accepts chunked as the only transfer coding, since
+// no other coding can be decoded and chunked must be applied exactly once, as
+// the final coding.
+func validateTransferEncoding(values []string) error {
+	codings := strings.Split(strings.Join(values, ","), ",")
+	if len(codings) != 1 || !headers.EqualFold(strings.TrimSpace(codings[0]), "chunked") {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedTransferEncoding, strings.Join(values, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmugglingPayloads(t *testing.T) {
+	const smuggled = "GET /admin HTTP/1.1\r\nHost: localhost\r\n\r\n"
+
+	tests := []struct {
+		name string
+		head string
+		err error
+	}{
+		// CL.CL: two parsers picking different Content-Length values.
+		{"conflicting Content-Length", "Content-Length: 5\r\nContent-Length: 44\r\n", ErrDuplicateContentLength},
+		{"identical Content-Length", "Content-Length: 44\r\nContent-Length: 44\r\n", ErrDuplicateContentLength},
+		{"Content-Length list", "Content-Length: 44, 44\r\n", ErrDuplicateContentLength},
+
+		// CL.TE and TE.CL: one parser using each header.
+		{"Content-Length then Transfer-Encoding", "Content-Length: 44\r\nTransfer-Encoding: chunked\r\n", ErrContentLengthWithTransferEncoding},
+		{"Transfer-Encoding then Content-Length", "Transfer-Encoding: chunked\r\nContent-Length: 44\r\n", ErrContentLengthWithTransferEncoding},
+
+		// TE.TE: obfuscated Transfer-Encoding only one parser recognizes.
+		{"unknown coding", "Transfer-Encoding: xchunked\r\n", ErrUnsupportedTransferEncoding},
+		{"coding before chunked", "Transfer-Encoding: gzip, chunked\r\n", ErrUnsupportedTransferEncoding},
+		{"coding after chunked", "Transfer-Encoding: chunked, identity\r\n", ErrUnsupportedTransferEncoding},
+		{"chunked twice", "Transfer-Encoding: chunked, chunked\r\n", ErrUnsupportedTransferEncoding},
+		{"repeated Transfer-Encoding fields", "Transfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n", ErrUnsupportedTransferEncoding},
+		{"empty Transfer-Encoding", "Transfer-Encoding: \r\n", ErrUnsupportedTransferEncoding},
+		{"space before colon", "Transfer-Encoding : chunked\r\n", headers.ErrWhitespaceBeforeColon},
+		{"tab before colon", "Content-Length\t: 44\r\n", headers.ErrWhitespaceBeforeColon},
+		{"long s in Transfer-Encoding", "Tran\u017ffer-Encoding: chunked\r\n", ErrInvalidHeaderName},
+		{"Cyrillic e in Content-Length", "Cont\u0435nt-Length: 44\r\n", ErrInvalidHeaderName},
+		{"Kelvin sign in chunked", "Transfer-Encoding: chun\u212aed\r\n", ErrUnsupportedTransferEncoding},
+
+		// Content-Length values parsers disagree on.
+		{"plus sign", "Content-Length: +44\r\n", ErrInvalidContentLength},
+		{"negative", "Content-Length: -1\r\n", ErrInvalidContentLength},
+		{"leading zero", "Content-Length: 044\r\n", ErrInvalidContentLength},
+		{"hexadecimal", "Content-Length: 0x2c\r\n", ErrInvalidContentLength},
+		{"exponent", "Content-Length: 4e1\r\n", ErrInvalidContentLength},
+		{"internal space", "Content-Length: 4 4\r\n", ErrInvalidContentLength},
+		{"empty", "Content-Length: \r\n", ErrInvalidContentLength},
+		{"overflow", "Content-Length: 99999999999999999999999\r\n", ErrInvalidContentLength},
+
+		// framing headers hidden from one of the parsers.
+		{"obs-fold", "X-Padding: a\r\n Transfer-Encoding: chunked\r\n", nil},
+		{"obs-fold of Transfer-Encoding", "Transfer-Encoding: identity\r\n chunked\r\n", headers.ErrObsFold},
+		{"bare CR", "X-Padding: a\rTransfer-Encoding: chunked\r\n", nil},
+		{"bare LF", "X-Padding: a\nTransfer-Encoding: chunked\r\n", nil},
+		{"NUL in value", "Transfer-Encoding: chunked\x00\r\n", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewReader(&chunkReader{
+				data: "POST / HTTP/1.1\r\nHost: localhost\r\n" + test.head + "\r\n0\r\n\r\n" + smuggled,
+				numBytesPerRead: 7,
+			})
+			_, err := reader.ReadRequest()
+			require.Error(t, err)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+			}
+		})
+	}
+
+	// Test: Framing headers on a first field line starting with whitespace,
+	// which other parsers ignore or fold into the request line
+	for _, options := range []ParserOptions{StrictParsing, LenientParsing} {
+		for _, head := range []string{" Transfer-Encoding: chunked\r\n", "\tContent-Length: 3\r\n"} {
+			reader := NewReader(&chunkReader{
+				data: "POST / HTTP/1.1\r\n" + head + "Host: localhost\r\n\r\nabc" + smuggled,
+				numBytesPerRead: 7,
+			})
+			reader.SetParserOptions(options)
+			_, err := reader.ReadRequest()
+			require.ErrorIs(t, err, headers.ErrWhitespaceBeforeFieldName, "%q", head)
+		}
+	}
+
+	// Test: Transfer-Encoding in HTTP/1.0
+	_, err := RequestFromReader(&chunkReader{
+		data: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 7,
+	})
+	require.ErrorIs(t, err, ErrUnsupportedTransferEncoding)
+}
+
+func TestValidFraming(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		body string
+	}{
+		{"Content-Length", "Content-Length: 5\r\n", "hello"},
+		{"zero Content-Length", "Content-Length: 0\r\n", ""},
+		{"Content-Length with optional whitespace", "Content-Length:  5 \r\n", "hello"},
+		{"chunked", "Transfer-Encoding: chunked\r\n", "5\r\nhello\r\n0\r\n\r\n"},
+		{"chunked in upper case", "Transfer-Encoding: Chunked\r\n", "5\r\nhello\r\n0\r\n\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewReader(&chunkReader{
+				data: "POST / HTTP/1.1\r\nHost: localhost\r\n" + test.head + "\r\n" + test.body + "GET /next HTTP/1.1\r\n\r\n",
+				numBytesPerRead: 7,
+			})
+			r, err := reader.ReadRequest()
+			require.NoError(t, err)
+			readBody(t, r)
+
+			// the next request starts exactly where the body ends.
+			r, err = reader.ReadRequest()
+			require.NoError(t, err)
+			assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzLimits keep the work per input small, so the fuzzer spends its time on
+// the parser instead of on buffering huge bodies.
+var fuzzLimits = Limits{
+	MaxRequestLineBytes: 1024,
+	MaxHeaderBytes: 4096,
+	MaxHeaderCount: 32,
+	MaxBodyBytes: 4096,
+}
+
+// splitReader returns data in reads of varying size, taken in turn from
+// sizes, to exercise every way a request can be split across reads.
+type splitReader struct {
+	data []byte
+	sizes []byte
+	reads int
+}
+
+func (sr *splitReader) Read(p []byte) (int, error) {
+	if len(sr.data) == 0 {
+		return 0, io.EOF
+	}
+	size := 1
+	if len(sr.sizes) > 0 {
+		size += int(sr.sizes[sr.reads % len(sr.sizes)])
+	}
+	sr.reads++
+	n := copy(p, sr.data[:min(size, len(sr.data))])
+	sr.data = sr.data[n:]
+	return n, nil
+}
+
+// writtenFields returns the header fields WriteTo writes for a received
+// request: the coding is spelled in lower case, Host is added for absolute
+// targets and empty bodies of POST, PUT and PATCH requests are announced.
+func writtenFields(r *Request) []headers.Field {
+	fields := r.Headers.Fields()
+	for i, field := range fields {
+		if strings.EqualFold(field.Name, "Transfer-Encoding") {
+			fields[i].Value = "chunked"
+		}
+	}
+	if _, hasHost := r.Headers.Get("Host"); !hasHost && r.URL.Host != "" {
+		fields = append([]headers.Field{{Name: "Host", Value: r.URL.Host}}, fields...)
+	}
+	_, hasLength := r.Headers.Get("Content-Length")
+	_, isChunked := r.Headers.Get("Transfer-Encoding")
+	if !hasLength && !isChunked && slices.Contains([]string{"POST", "PUT", "PATCH"}, r.RequestLine.Method) {
+		fields = append(fields, headers.Field{Name: "Content-Length", Value: "0"})
+	}
+	return fields
+}
+
+// readFuzzRequest reads a request and its complete body from data.
+func readFuzzRequest(data, sizes []byte, options ParserOptions) (*Reader, *Request, []byte, error) {
+	reader := NewReader(&splitReader{data: data, sizes: sizes})
+	reader.SetLimits(fuzzLimits)
+	reader.SetParserOptions(options)
+	r, err := reader.ReadRequest()
+	if err != nil {
+		return reader, nil, nil, err
+	}
+	body, err := io.ReadAll(r.Body)
+	return reader, r, body, err
+}
+
+func FuzzRequestFromReader(f *testing.F) {
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"), []byte{0})
+	f.Add([]byte("POST /submit HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello"), []byte{3, 7})
+	f.Add([]byte("POST /submit HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nX-Checksum: abc\r\n\r\n"), []byte{1, 2, 4, 8})
+	f.Add([]byte("GET http://example.com:8080/a/b?c=d HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"), []byte{255})
+	f.Add([]byte("\nGET  /  HTTP/1.1\nX-Folded: a\n\tb\n\n"), []byte{5})
+
+	f.Fuzz(func(t *testing.T, data []byte, sizes []byte) {
+		for _, options := range []ParserOptions{StrictParsing, LenientParsing} {
+			reader, r, body, err := readFuzzRequest(data, sizes, options)
+
+			// the buffer only grows when it is full, so it never needs to
+			// be much larger than the input.
+			require.LessOrEqual(t, cap(reader.reader.Buffered()), 2 * max(len(data), 8))
+			require.LessOrEqual(t, int64(len(body)), fuzzLimits.MaxBodyBytes)
+
+			if err != nil {
+				// input errors are reported as ParseError, so the server
+				// can answer them properly.
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					require.ErrorIs(t, err, io.EOF)
+				}
+				continue
+			}
+
+			// serializing a request and parsing it again gives the same
+			// request.
+			var serialized bytes.Buffer
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			_, err = r.WriteToWithOptions(&serialized, WriteOptions{PreserveHeaderOrder: true, PreserveHeaderCase: true})
+			require.NoError(t, err)
+			_, again, againBody, err := readFuzzRequest(serialized.Bytes(), nil, StrictParsing)
+			require.NoError(t, err, "%q", serialized.Bytes())
+			assert.Equal(t, r.RequestLine.Method, again.RequestLine.Method)
+			assert.Equal(t, r.RequestLine.RequestTarget, again.RequestLine.RequestTarget)
+			assert.Equal(t, "1.1", again.RequestLine.HttpVersion)
+			assert.Equal(t, r.URL, again.URL)
+			assert.Equal(t, writtenFields(r), again.Headers.Fields())
+			assert.Equal(t, body, againBody)
+			assert.Equal(t, r.Trailers.Fields(), again.Trailers.Fields())
+		}
+	})
+}
+
+func FuzzParseRequestLine(f *testing.F) {
+	f.Add("GET / HTTP/1.1")
+	f.Add("OPTIONS * HTTP/1.1")
+	f.Add("CONNECT example.com:443 HTTP/1.1")
+	f.Add("GET http://example.com/a?b HTTP/1.0")
+	f.Add(" GET\t/index.html  HTTP/1.1 ")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		for _, options := range []ParserOptions{StrictParsing, LenientParsing} {
+			requestLine, err := parseRequestLine(line, options)
+			if err != nil {
+				continue
+			}
+			require.NotEmpty(t, requestLine.Method)
+			require.NotEmpty(t, requestLine.RequestTarget)
+			require.Contains(t, []string{"1.0", "1.1"}, requestLine.HttpVersion)
+
+			// the canonical form of the line is accepted in strict mode.
+			canonical := fmt.Sprintf("%s %s HTTP/%s", requestLine.Method, requestLine.RequestTarget, requestLine.HttpVersion)
+			again, err := parseRequestLine(canonical, StrictParsing)
+			require.NoError(t, err, "%q", canonical)
+			require.Equal(t, requestLine, again)
+			if !options.AllowExtraWhitespace {
+				require.Equal(t, line, canonical)
+			}
+		}
+	})
+}
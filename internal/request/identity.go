@@ -0,0 +1,30 @@
+package request
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+)
+
+// ClientIdentity is the identity of a client authenticated by a verified TLS
+// client certificate.
+type ClientIdentity struct {
+	Subject pkix.Name
+	DNSNames []string
+	EmailAddresses []string
+	IPAddresses []net.IP
+	URIs []*url.URL
+	Certificate *x509.Certificate
+}
+
+func NewClientIdentity(certificate *x509.Certificate) *ClientIdentity {
+	return &ClientIdentity{
+		Subject: certificate.Subject,
+		DNSNames: certificate.DNSNames,
+		EmailAddresses: certificate.EmailAddresses,
+		IPAddresses: certificate.IPAddresses,
+		URIs: certificate.URIs,
+		Certificate: certificate,
+	}
+}
@@ -0,0 +1,31 @@
+package request
+
+import "errors"
+
+var (
+	ErrRequestLineTooLong = errors.New("Request line too long")
+	ErrHeaderTooLarge = errors.New("Request header fields too large")
+	ErrTooManyHeaders = errors.New("Too many request header fields")
+	ErrBodyTooLarge = errors.New("Request body too large")
+)
+
+// Limits bound the resources a single request may use. A value of zero
+// disables the corresponding limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	// MaxHeaderBytes applies to all header lines together, including the
+	// trailers of a chunked body.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	MaxBodyBytes int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 * 1024,
+	MaxHeaderBytes: 1024 * 1024,
+	MaxHeaderCount: 100,
+}
+
+func exceeds(length int, limit int) bool {
+	return limit > 0 && length > limit
+}
@@ -0,0 +1,45 @@
+package request
+
+import "github.com/MrBhop/httpfromtcp/internal/headers"
+
+// ParserOptions control which deviations from RFC 9112 the parser tolerates.
+// The zero value is StrictParsing.
+type ParserOptions struct {
+	// AllowBareLF accepts a bare LF as line ending in addition to CRLF.
+	AllowBareLF bool
+	// AllowLeadingEmptyLines ignores empty lines received before the request
+	// line, which some clients send after the body of a previous request.
+	AllowLeadingEmptyLines bool
+	// AllowExtraWhitespace accepts runs of whitespace between the parts of
+	// the request line and around it, instead of single spaces.
+	AllowExtraWhitespace bool
+	// AllowObsFold replaces obsolete line folding in header fields with a
+	// space instead of rejecting the request.
+	AllowObsFold bool
+}
+
+var (
+	// StrictParsing follows the grammar of RFC 9112 exactly.
+	StrictParsing = ParserOptions{}
+	// LenientParsing accepts the deviations RFC 9112 allows recipients to
+	// tolerate for robustness.
+	LenientParsing = ParserOptions{
+		AllowBareLF: true,
+		AllowLeadingEmptyLines: true,
+		AllowExtraWhitespace: true,
+		AllowObsFold: true,
+	}
+)
+
+func (o ParserOptions) headerOptions() headers.ParseOptions {
+	return headers.ParseOptions{
+		AllowObsFold: o.AllowObsFold,
+		AllowBareLF: o.AllowBareLF,
+	}
+}
+
+// isLenientWhitespace reports whether c separates the parts of the request
+// line in lenient mode (RFC 9112, section 3).
+func isLenientWhitespace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\v' || c == '\f' || c == '\r'
+}
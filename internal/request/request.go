@@ -1,14 +1,15 @@
 package request
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
-	"unicode"
 
-	"github.com/MrBhop/httpfromtcp/internal/constants"
+	"github.com/MrBhop/httpfromtcp/internal/framing"
 	"github.com/MrBhop/httpfromtcp/internal/headers"
 )
 
@@ -17,15 +18,36 @@ type parserState int
 const (
 	requestStateParsingInitialized parserState = iota
 	requestStateParsingHeaders
-	requestStateParsingBody
 	requestStateParsingDone
 )
 
 type Request struct {
 	state parserState
 	RequestLine RequestLine
-	Headers headers.Headers
-	Body []byte
+	URL *URL
+	Headers *headers.Headers
+	// Body streams the request body from the connection. Trailers are only
+	// populated once Body has been read to the end.
+	Body io.ReadCloser
+	Trailers *headers.Headers
+	PathParams map[string]string
+	// RemoteAddr is the network address of the client, set by the server.
+	RemoteAddr string
+	// TLS holds the state of the TLS connection the request was received on,
+	// or nil for plain connections.
+	TLS *tls.ConnectionState
+	// ClientIdentity describes the client certificate verified during the
+	// TLS handshake, or is nil if the client did not present one.
+	ClientIdentity *ClientIdentity
+	body *body
+	chunked bool
+	contentLength int
+	limits Limits
+	options ParserOptions
+	// offset counts the bytes of the request head consumed so far.
+	offset int64
+	headerBytes int
+	headerCount int
 }
 
 type RequestLine struct {
@@ -34,48 +56,141 @@ type RequestLine struct {
 	Method string
 }
 
+type Reader struct {
+	reader *framing.Reader
+	current *Request
+	limits Limits
+	options ParserOptions
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: framing.NewReader(reader),
+		limits: DefaultLimits,
+	}
+}
+
+// SetLimits replaces DefaultLimits for the requests read after the call.
+func (r *Reader) SetLimits(limits Limits) {
+	r.limits = limits
+}
+
+// SetParserOptions replaces StrictParsing for the requests read after the
+// call.
+func (r *Reader) SetParserOptions(options ParserOptions) {
+	r.options = options
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
+
+// ReadRequest parses the request line and headers of the next request from
+// the underlying reader. The body is not read, it is streamed through
+// Request.Body and must be consumed before the next request can be read.
+// Bytes read past the end of a request are kept for the next call, so
+// pipelined requests on the same connection are not lost. io.EOF is returned
+// if the reader is exhausted before any byte of a new request was received.
+func (r *Reader) ReadRequest() (*Request, error) {
+	if r.current != nil && !r.current.body.framed.Done() {
+		return nil, fmt.Errorf("Previous request body has not been fully read")
+	}
+
 	request := &Request{
 		state: requestStateParsingInitialized,
 		Headers: headers.NewHeaders(),
-		Body: make([]byte, 0),
+		Trailers: headers.NewHeaders(),
+		limits: r.limits,
+		options: r.options,
 	}
-	buffer := make([]byte, constants.BufferLength)
-	usedBufferLength := 0
-
-	for request.state != requestStateParsingDone {
-		if capacity := cap(buffer); usedBufferLength >= capacity {
-			newBuffer := make([]byte, capacity * 2)
-			copy(newBuffer, buffer)
-			buffer = newBuffer
-		}
 
-		bytesRead, err := reader.Read(buffer[usedBufferLength:])
+	for request.parsingHead() {
+		bytesParsed, err := request.parse(r.reader.Buffered())
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, fmt.Errorf("Invalid request format - no crlf found")
-			}
-
 			return nil, err
 		}
+		r.reader.Consume(bytesParsed)
 
-		usedBufferLength += bytesRead
-		bytesParsed, err := request.parse(buffer[:usedBufferLength])
-		if err != nil {
-			return nil, err
+		if !request.parsingHead() {
+			break
 		}
 
-		copy(buffer, buffer[bytesParsed:])
-		usedBufferLength -= bytesParsed
+		bytesRead, err := r.reader.Fill()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if bytesRead > 0 {
+				continue
+			}
+			if request.state == requestStateParsingInitialized && len(r.reader.Buffered()) == 0 {
+				return nil, io.EOF
+			}
+			return nil, &ParseError{
+				Offset: request.offset + int64(len(r.reader.Buffered())),
+				HttpVersion: request.RequestLine.HttpVersion,
+				Err: fmt.Errorf("%w: %w", ErrIncompleteRequest, io.ErrUnexpectedEOF),
+			}
+		}
 	}
 
+	request.body = newBody(r.reader, request)
+	request.Body = request.body
+	r.current = request
 	return request, nil
 }
 
+// WaitForData blocks until at least one byte of the next request has been
+// received. io.EOF is returned if the reader is exhausted first.
+func (r *Reader) WaitForData() error {
+	return r.reader.WaitForData()
+}
+
+// PathValue returns the value of the named path parameter captured by the
+// router, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.PathParams[name]
+}
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.1 connections are persistent unless closed
+// explicitly, HTTP/1.0 ones only if the client asks for keep-alive.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// DiscardBody reads and drops up to limit bytes of the unread body. It
+// reports whether the end of the body was reached, which is required to
+// read the next request from the same connection.
+func (r *Request) DiscardBody(limit int) bool {
+	if r.body == nil {
+		return false
+	}
+	return r.body.framed.Discard(limit)
+}
+
+// BodyErr returns the error that stopped reading the body, if any.
+func (r *Request) BodyErr() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.err
+}
+
+func (r *Request) parsingHead() bool {
+	return r.state == requestStateParsingInitialized || r.state == requestStateParsingHeaders
+}
+
 func (r *Request) parse(next []byte) (int, error) {
 	totalBytesParsed := 0
-	for r.state != requestStateParsingDone {
-		n, err := r.parseSingle(next[totalBytesParsed:])
+	for r.parsingHead() {
+		n, err := r.parseNext(next[totalBytesParsed:])
 		if err != nil {
 			return totalBytesParsed, err
 		}
@@ -89,49 +204,62 @@ func (r *Request) parse(next []byte) (int, error) {
 	return totalBytesParsed, nil
 }
 
+// parseNext parses the next element of the request head, wrapping errors
+// in a ParseError that records where the element starts.
+func (r *Request) parseNext(next []byte) (int, error) {
+	n, err := r.parseSingle(next)
+	if err != nil {
+		return 0, &ParseError{Offset: r.offset, HttpVersion: r.RequestLine.HttpVersion, Err: err}
+	}
+	r.offset += int64(n)
+	return n, nil
+}
+
 func (r *Request) parseSingle(next []byte) (int, error) {
 	switch r.state {
 	case requestStateParsingInitialized:
-		parsedBytes, requestLine, err := parseRequestLine(next)
+		line, n, err := headers.FindLine(next, r.options.AllowBareLF)
 		if err != nil {
 			return 0, err
 		}
-		if parsedBytes > 0 {
-			r.RequestLine = *requestLine
-			r.state = requestStateParsingHeaders
+		if n == 0 {
+			// detect overlong lines before they are complete.
+			if exceeds(len(next), r.limits.MaxRequestLineBytes) {
+				return 0, ErrRequestLineTooLong
+			}
+			return 0, nil
 		}
-		return parsedBytes, nil
-	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(next)
+		if exceeds(len(line), r.limits.MaxRequestLineBytes) {
+			return 0, ErrRequestLineTooLong
+		}
+		if len(line) == 0 && r.options.AllowLeadingEmptyLines {
+			return n, nil
+		}
+
+		requestLine, err := parseRequestLine(string(line), r.options)
 		if err != nil {
 			return 0, err
 		}
-		if done {
-			r.state = requestStateParsingBody
+		r.RequestLine = *requestLine
+		url, err := parseRequestTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
 		}
+		r.URL = url
+		r.state = requestStateParsingHeaders
 		return n, nil
-	case requestStateParsingBody:
-		contentLengthString, exists := r.Headers.Get("Content-Length")
-		if !exists {
-			r.state = requestStateParsingDone
-			return len(next), nil
-		}
-
-		contentLength, err := strconv.Atoi(contentLengthString)
+	case requestStateParsingHeaders:
+		n, done, err := r.parseHeaderLine(r.Headers, next)
 		if err != nil {
-			return 0, fmt.Errorf("Malformed Content-Length: %w", err)
-		}
-
-		r.Body = append(r.Body, next...)
-
-		if bodyLength := len(r.Body); bodyLength > contentLength {
-			return 0, fmt.Errorf("Mismatching content-length. Expected %d, got %d", contentLength, bodyLength)
+			return 0, err
 		}
-
-		if len(r.Body) == contentLength {
+		if done {
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
 			r.state = requestStateParsingDone
 		}
-		return len(next), nil
+		return n, nil
 	case requestStateParsingDone:
 		return 0, fmt.Errorf("Cannot parse in a done state")
 	default:
@@ -139,31 +267,97 @@ func (r *Request) parseSingle(next []byte) (int, error) {
 	}
 }
 
-func parseRequestLine(line []byte) (int, *RequestLine, error) {
-	n := strings.Index(string(line), constants.CrLf)
-	if n == -1 {
-		return 0, nil, nil
+// parseHeaderLine parses a single header or trailer line into h, enforcing
+// the header limits before the line is complete.
+func (r *Request) parseHeaderLine(h *headers.Headers, next []byte) (int, bool, error) {
+	n, done, err := h.ParseWithOptions(next, r.options.headerOptions())
+	if err != nil {
+		return 0, false, err
+	}
+	if n == 0 {
+		if exceeds(r.headerBytes + len(next), r.limits.MaxHeaderBytes) {
+			return 0, false, ErrHeaderTooLarge
+		}
+		return 0, false, nil
+	}
+
+	r.headerBytes += n
+	if exceeds(r.headerBytes, r.limits.MaxHeaderBytes) {
+		return 0, false, ErrHeaderTooLarge
+	}
+	if !done {
+		r.headerCount++
+		if exceeds(r.headerCount, r.limits.MaxHeaderCount) {
+			return 0, false, ErrTooManyHeaders
+		}
+	}
+	return n, done, nil
+}
+
+// startBody determines how the body is framed once all headers are parsed.
+// The body itself is read through Request.Body.
+func (r *Request) startBody() error {
+	transferEncodings := r.Headers.Values("Transfer-Encoding")
+	contentLengths := r.Headers.Values("Content-Length")
+
+	if len(transferEncodings) > 0 {
+		// HTTP/1.0 has no Transfer-Encoding, so the framing of such a
+		// request cannot be trusted (RFC 9112, section 6.1).
+		if r.RequestLine.HttpVersion == "1.0" {
+			return fmt.Errorf("%w in HTTP/1.0 requests", ErrUnsupportedTransferEncoding)
+		}
+		if len(contentLengths) > 0 {
+			return ErrContentLengthWithTransferEncoding
+		}
+		if err := validateTransferEncoding(transferEncodings); err != nil {
+			return err
+		}
+		r.chunked = true
+		return nil
+	}
+
+	if len(contentLengths) == 0 {
+		return nil
+	}
+
+	contentLength, err := framing.ParseContentLength(contentLengths)
+	if err != nil {
+		return err
+	}
+	if r.limits.MaxBodyBytes > 0 && int64(contentLength) > r.limits.MaxBodyBytes {
+		return ErrBodyTooLarge
 	}
 
-	lineString := string(line[:n])
-	fields := strings.Fields(lineString)
+	r.contentLength = contentLength
+	return nil
+}
+
+// parseRequestLine parses a request line without its line ending. Strict
+// parsing requires the parts to be separated by single spaces.
+func parseRequestLine(line string, options ParserOptions) (*RequestLine, error) {
+	var fields []string
+	if options.AllowExtraWhitespace {
+		fields = strings.FieldsFunc(line, isLenientWhitespace)
+	} else {
+		fields = strings.Split(line, " ")
+	}
 	if length := len(fields); length != 3 {
-		return 0, nil, fmt.Errorf("Request lines has incorrect number of whitespace delimited fields. Expected 3, got %d", length)
+		return nil, fmt.Errorf("%w: expected 3 whitespace delimited fields, got %d", ErrMalformedRequestLine, length)
+	}
+	if slices.Contains(fields, "") {
+		return nil, fmt.Errorf("%w: empty field", ErrMalformedRequestLine)
 	}
 
 	output := RequestLine {
 		RequestTarget: fields[1],
 	}
 
-	// validate Method.
+	// validate Method. Any token is a method (RFC 9110, section 9.1), which
+	// is case-sensitive, so "Get" is not GET but a method of its own.
 	method := fields[0]
-	if upperCaseMethod := strings.ToUpper(method); upperCaseMethod != method {
-		return 0, nil, fmt.Errorf("Method contains non uppercase characters.")
-	}
-
-	for _, r := range method {
-		if !unicode.IsLetter(r) {
-			return 0, nil, fmt.Errorf("Method contains non alphabetic characters.")
+	for i := 0; i < len(method); i++ {
+		if !headers.IsTchar(method[i]) {
+			return nil, fmt.Errorf("%w: invalid character %q in method", ErrMalformedRequestLine, method[i])
 		}
 	}
 
@@ -173,33 +367,33 @@ func parseRequestLine(line []byte) (int, *RequestLine, error) {
 	// general validation.
 	versionString := []byte(fields[2])
 	if length := len(versionString); length != 8 {
-		return 0, nil, fmt.Errorf("HTTP-version is malformed. Expected length == 8, got %d", length)
+		return nil, fmt.Errorf("%w: expected HTTP-version of length 8, got %d", ErrMalformedRequestLine, length)
 	}
 
 	if versionStart := string(versionString[:5]); versionStart != "HTTP/" {
-		return 0, nil, fmt.Errorf("HTTP-version is malformed. Expected to start with HTTP/, got: '%s'", versionStart)
+		return nil, fmt.Errorf("%w: expected HTTP-version to start with HTTP/, got: '%s'", ErrMalformedRequestLine, versionStart)
 	}
 
 	digit1 := string(versionString[5])
 	if _, err := strconv.Atoi(digit1); err != nil {
-		return 0, nil, fmt.Errorf("HTTP-version is malformed. Expected 6th char to be digit, got: '%s'", digit1)
+		return nil, fmt.Errorf("%w: expected 6th char of HTTP-version to be digit, got: '%s'", ErrMalformedRequestLine, digit1)
 	}
 
 	if dot := string(versionString[6]); dot != "." {
-		return 0, nil, fmt.Errorf("HTTP-version is malformed. Expected 7th chat to be '.', got: '%s'", dot)
+		return nil, fmt.Errorf("%w: expected 7th char of HTTP-version to be '.', got: '%s'", ErrMalformedRequestLine, dot)
 	}
 	
 	digit2 := string(versionString[7])
 	if _, err := strconv.Atoi(digit2); err != nil {
-		return 0, nil, fmt.Errorf("HTTP-version is malformed. Expected 8th char to be digit, got: '%s'", digit1)
+		return nil, fmt.Errorf("%w: expected 8th char of HTTP-version to be digit, got: '%s'", ErrMalformedRequestLine, digit2)
 	}
 
 	output.HttpVersion = digit1 + "." + digit2
 
 	// version specific validation.
-	if !(output.HttpVersion == "1.1") {
-		return 0, nil, fmt.Errorf("This application only supports 1.1, got: %s", output.HttpVersion)
+	if output.HttpVersion != "1.0" && output.HttpVersion != "1.1" {
+		return nil, fmt.Errorf("%w: only 1.0 and 1.1 are supported, got: %s", ErrUnsupportedVersion, output.HttpVersion)
 	}
 
-	return n + 2, &output, nil
+	return &output, nil
 }
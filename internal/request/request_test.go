@@ -2,8 +2,10 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
+	"github.com/MrBhop/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +32,17 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+func readBody(t *testing.T, r *Request) string {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func fieldValue(h *headers.Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 func TestRequestLineParser(t *testing.T) {
 	// Test: Good GET Request line
 	reader := &chunkReader{
@@ -80,21 +93,26 @@ func TestRequestLineParser(t *testing.T) {
 	_, err = RequestFromReader(reader)
 	require.Error(t, err)
 
-	// Test: Method is not uppercase
-	reader = &chunkReader {
-		data: "Get / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
-		numBytesPerRead: 9,
+	// Test: Methods are case-sensitive tokens
+	for _, method := range []string{"Get", "GET1", "M-SEARCH", "X_CUSTOM.METHOD!"} {
+		reader = &chunkReader {
+			data: method + " / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+			numBytesPerRead: 9,
+		}
+		r, err = RequestFromReader(reader)
+		require.NoError(t, err, method)
+		assert.Equal(t, method, r.RequestLine.Method)
 	}
-	_, err = RequestFromReader(reader)
-	require.Error(t, err)
-	
-	// Test: Method contains numbers
-	reader = &chunkReader {
-		data: "GET1 / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
-		numBytesPerRead: 3,
+
+	// Test: Method contains characters other than tchar
+	for _, method := range []string{"GE(T", "GET/1", "G\"ET", "GÉT", "GET\x00"} {
+		reader = &chunkReader {
+			data: method + " / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrMalformedRequestLine, "%q", method)
 	}
-	_, err = RequestFromReader(reader)
-	require.Error(t, err)
 
 	// Test: Malformed version string
 	reader = &chunkReader {
@@ -148,19 +166,19 @@ func TestRequestLineParser(t *testing.T) {
 func TestHeaderParser(t *testing.T) {
 	// Test: Standard Headers
 	reader := &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		data: "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", fieldValue(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", fieldValue(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", fieldValue(r.Headers, "accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost localhost:42069\r\n\r\n",
+		data: "GET / HTTP/1.1\r\nHost localhost:42069\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
@@ -174,37 +192,55 @@ func TestHeaderParser(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, 0, len(r.Headers))
+	assert.Equal(t, 0, r.Headers.Len())
 
 	// Test: Duplicate Header
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: localhost:8000\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		data: "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: localhost:8000\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 		numBytesPerRead: 1,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:8000", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069, localhost:8000", fieldValue(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", fieldValue(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", fieldValue(r.Headers, "accept"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nhosT: localhost:8000\r\n\r\n",
+		data: "GET / HTTP/1.1\r\nHost: localhost:42069\r\nhosT: localhost:8000\r\n\r\n",
 		numBytesPerRead: 1,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:8000", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:8000", fieldValue(r.Headers, "host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n",
+		data: "GET / HTTP/1.1\r\nHost: localhost:42069\r\n",
 		numBytesPerRead: 1,
 	}
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: Field values with internal whitespace
+	reader = &chunkReader{
+		data: "GET / HTTP/1.1\r\nUser-Agent: Mozilla/5.0 (X11; Linux x86_64)\r\nAccept: text/html, application/json\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", fieldValue(r.Headers, "user-agent"))
+	assert.Equal(t, "text/html, application/json", fieldValue(r.Headers, "accept"))
+
+	// Test: Obsolete line folding is rejected
+	reader = &chunkReader{
+		data: "GET / HTTP/1.1\r\nX-Folded: a\r\n b\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
 }
 
 func TestBodyParsing(t *testing.T) {
@@ -220,7 +256,7 @@ func TestBodyParsing(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "hello world!\n", readBody(t, r))
 
 	// Test: Empty Body, 0 reported content length
 	reader = &chunkReader{
@@ -233,7 +269,7 @@ func TestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -245,7 +281,7 @@ func TestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -257,7 +293,9 @@ func TestBodyParsing(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
-	require.Error(t, err)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
 
 	// Test: No Content-Length but Body Exists
 	reader = &chunkReader{
@@ -270,5 +308,465 @@ func TestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Two requests in one stream, the first with a body
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello" +
+		"GET /coffee HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Connection: close\r\n" +
+		"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean end of stream between requests
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: End of stream in the middle of a request
+	reader = NewReader(&chunkReader{
+		data: "GET / HTTP/1.1\r\nHost: local",
+		numBytesPerRead: 4,
+	})
+	_, err = reader.ReadRequest()
+	require.Error(t, err)
+	require.NotErrorIs(t, err, io.EOF)
+}
+
+func TestChunkedBodyParsing(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"6\r\n" +
+		"hello \r\n" +
+		"7\r\n" +
+		"world!\n\r\n" +
+		"0\r\n" +
+		"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", readBody(t, r))
+	assert.Equal(t, 0, r.Trailers.Len())
+
+	// Test: Chunk extensions and uppercase hex sizes
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"A;name=value\r\n" +
+		"0123456789\r\n" +
+		"0;last\r\n" +
+		"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", readBody(t, r))
+
+	// Test: Trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-Checksum\r\n" +
+		"\r\n" +
+		"5\r\n" +
+		"hello\r\n" +
+		"0\r\n" +
+		"X-Checksum: abc123\r\n" +
+		"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.Equal(t, "abc123", fieldValue(r.Trailers, "x-checksum"))
+
+	// Test: Chunked request followed by a pipelined request
+	requestReader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"2\r\nhi\r\n0\r\n\r\n" +
+		"GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	r, err = requestReader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "hi", readBody(t, r))
+	r, err = requestReader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"xyz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Unsupported transfer coding
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: gzip\r\n" +
+		"\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestRequestTargetParsing(t *testing.T) {
+	parse := func(requestLine string) (*Request, error) {
+		return RequestFromReader(&chunkReader{
+			data: requestLine + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 4,
+		})
+	}
+
+	// Test: Origin-form with query parameters
+	r, err := parse("GET /search?q=hello+world&tag=a&tag=b%26c&empty HTTP/1.1")
+	require.NoError(t, err)
+	require.NotNil(t, r.URL)
+	assert.Equal(t, TargetOriginForm, r.URL.Form)
+	assert.Equal(t, "/search", r.URL.Path)
+	assert.Equal(t, "q=hello+world&tag=a&tag=b%26c&empty", r.URL.RawQuery)
+	assert.Equal(t, "hello world", r.URL.Query.Get("q"))
+	assert.Equal(t, []string{"a", "b&c"}, r.URL.Query["tag"])
+	assert.True(t, r.URL.Query.Has("empty"))
+	assert.False(t, r.URL.Query.Has("missing"))
+	assert.Equal(t, "/search?q=hello+world&tag=a&tag=b%26c&empty", r.RequestLine.RequestTarget)
+
+	// Test: Percent-decoded path
+	r, err = parse("GET /caf%C3%A9/a%20b HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "/café/a b", r.URL.Path)
+	assert.Equal(t, "/caf%C3%A9/a%20b", r.URL.RawPath)
+
+	// Test: Path normalization
+	r, err = parse("GET //a/./b//c/../d/ HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b/d/", r.URL.Path)
+
+	r, err = parse("GET /a/b/.. HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "/a/", r.URL.Path)
+
+	// Test: Absolute-form
+	r, err = parse("GET HTTP://example.com:8080/index.html?x=1 HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAbsoluteForm, r.URL.Form)
+	assert.Equal(t, "http", r.URL.Scheme)
+	assert.Equal(t, "example.com:8080", r.URL.Host)
+	assert.Equal(t, "/index.html", r.URL.Path)
+	assert.Equal(t, "1", r.URL.Query.Get("x"))
+
+	r, err = parse("GET http://[::1]:8080 HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:8080", r.URL.Host)
+	assert.Equal(t, "/", r.URL.Path)
+
+	// Test: Authority-form
+	r, err = parse("CONNECT example.com:443 HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAuthorityForm, r.URL.Form)
+	assert.Equal(t, "example.com:443", r.URL.Host)
+
+	// Test: Asterisk-form
+	r, err = parse("OPTIONS * HTTP/1.1")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAsteriskForm, r.URL.Form)
+
+	// Test: Invalid targets
+	invalidRequestLines := []string{
+		"GET /../etc/passwd HTTP/1.1",
+		"GET /a/%2e%2e/%2e%2e/b HTTP/1.1",
+		"GET /a%2Fb HTTP/1.1",
+		"GET /a%00 HTTP/1.1",
+		"GET /a%zz HTTP/1.1",
+		"GET /a%4 HTTP/1.1",
+		"GET /?q=%G1 HTTP/1.1",
+		"GET * HTTP/1.1",
+		"GET example.com HTTP/1.1",
+		"GET ftp://example.com/ HTTP/1.1",
+		"GET http://user@example.com/ HTTP/1.1",
+		"GET http:///path HTTP/1.1",
+		"GET http://example.com:port/ HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT /path HTTP/1.1",
+	}
+	for _, requestLine := range invalidRequestLines {
+		_, err = parse(requestLine)
+		assert.Error(t, err, requestLine)
+	}
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Body is read on demand in small pieces
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Content-Length: 26\r\n" +
+		"\r\n" +
+		"abcdefghijklmnopqrstuvwxyz" +
+		"GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 64,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	piece := make([]byte, 10)
+	n, err := r.Body.Read(piece)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", string(piece[:n]))
+
+	// Test: Next request cannot be read before the body is consumed
+	_, err = reader.ReadRequest()
+	require.Error(t, err)
+
+	// Test: Reading a closed body fails
+	require.NoError(t, r.Body.Close())
+	_, err = r.Body.Read(piece)
+	require.ErrorIs(t, err, ErrBodyClosed)
+
+	// Test: Discarding the rest of the body allows reading the next request
+	assert.True(t, r.DiscardBody(1024))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "", readBody(t, r))
+
+	// Test: Discarding stops at the limit for large bodies
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"1a\r\nabcdefghijklmnopqrstuvwxyz\r\n0\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.DiscardBody(10))
+	assert.True(t, r.DiscardBody(1024))
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes: 64,
+		MaxHeaderCount: 3,
+		MaxBodyBytes: 10,
+	}
+	read := func(data string) (*Request, error) {
+		reader := NewReader(&chunkReader{
+			data: data,
+			numBytesPerRead: 4,
+		})
+		reader.SetLimits(limits)
+		return reader.ReadRequest()
+	}
+
+	// Test: Request within all limits
+	r, err := read("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\n\r\n0123456789")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", readBody(t, r))
+
+	// Test: Request line too long, detected before the line is complete
+	_, err = read("GET /" + strings.Repeat("a", 64))
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Request line too long
+	_, err = read("GET /" + strings.Repeat("a", 28) + " HTTP/1.1\r\n\r\n")
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Header bytes exceeded by a single unterminated line
+	_, err = read("GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 128))
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Header bytes exceeded by many lines
+	_, err = read("GET / HTTP/1.1\r\nA: 0123456789012345\r\nB: 0123456789012345\r\nC: 0123456789012345\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Too many header fields
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	require.ErrorIs(t, err, ErrTooManyHeaders)
+
+	// Test: Content-Length above the body limit is rejected before reading it
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body exceeding the body limit
+	r, err = read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\nworld!\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	require.ErrorIs(t, r.BodyErr(), ErrBodyTooLarge)
+
+	// Test: Trailers count towards the header limits
+	r, err = read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrTooManyHeaders)
+
+	// Test: Default limits apply without configuration
+	_, err = RequestFromReader(&chunkReader{
+		data: "GET / HTTP/1.1\r\n" + strings.Repeat("X-Header: value\r\n", 101) + "\r\n",
+		numBytesPerRead: 1024,
+	})
+	require.ErrorIs(t, err, ErrTooManyHeaders)
+}
+
+func TestHTTP10Requests(t *testing.T) {
+	read := func(data string) (*Request, error) {
+		return RequestFromReader(&chunkReader{
+			data: data,
+			numBytesPerRead: 3,
+		})
+	}
+
+	// Test: HTTP/1.0 request line
+	r, err := read("GET /index.html HTTP/1.0\r\nUser-Agent: old/1.0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.Equal(t, "/index.html", r.URL.Path)
+
+	// Test: HTTP/1.0 closes by default
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 with keep-alive
+	r, err = read("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 stays open by default, unless closed explicitly
+	r, err = read("GET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+	r, err = read("GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 with Content-Length body
+	r, err = read("POST /submit HTTP/1.0\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readBody(t, r))
+
+	// Test: Transfer-Encoding is rejected in HTTP/1.0
+	_, err = read("POST /submit HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	require.Error(t, err)
+}
+
+func TestParserOptions(t *testing.T) {
+	read := func(options ParserOptions, data string) (*Request, error) {
+		reader := NewReader(&chunkReader{
+			data: data,
+			numBytesPerRead: 3,
+		})
+		reader.SetParserOptions(options)
+		return reader.ReadRequest()
+	}
+
+	// Test: Bare LF line endings
+	const bareLF = "POST /submit HTTP/1.1\nHost: localhost\nTransfer-Encoding: chunked\n\n5\nhello\n0\nX-Trailer: yes\n\n"
+	_, err := read(StrictParsing, bareLF)
+	require.Error(t, err)
+	r, err := read(LenientParsing, bareLF)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", fieldValue(r.Headers, "host"))
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.Equal(t, "yes", fieldValue(r.Trailers, "x-trailer"))
+
+	// Test: Bare LF in the middle of a CRLF terminated request
+	_, err = read(StrictParsing, "GET / HTTP/1.1\r\nHost: localhost\nX-Other: a\r\n\r\n")
+	require.Error(t, err)
+
+	// Test: Leading empty lines
+	const leadingEmptyLines = "\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	_, err = read(StrictParsing, leadingEmptyLines)
+	require.Error(t, err)
+	r, err = read(LenientParsing, leadingEmptyLines)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+
+	// Test: Extra whitespace in the request line
+	for _, line := range []string{"GET  / HTTP/1.1", "GET\t/ HTTP/1.1", " GET / HTTP/1.1", "GET / HTTP/1.1 "} {
+		_, err = read(StrictParsing, line + "\r\n\r\n")
+		require.Error(t, err, "%q", line)
+		r, err = read(LenientParsing, line + "\r\n\r\n")
+		require.NoError(t, err, "%q", line)
+		assert.Equal(t, "/", r.RequestLine.RequestTarget)
+		assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+	}
+
+	// Test: Obsolete line folding
+	const folded = "GET / HTTP/1.1\r\nX-Folded: a\r\n\tb\r\n\r\n"
+	_, err = read(StrictParsing, folded)
+	require.Error(t, err)
+	r, err = read(LenientParsing, folded)
+	require.NoError(t, err)
+	assert.Equal(t, "a b", fieldValue(r.Headers, "x-folded"))
+
+	// Test: Lenient parsing still rejects malformed requests
+	_, err = read(LenientParsing, "GET /\r\n\r\n")
+	require.Error(t, err)
+	_, err = read(LenientParsing, "GET / HTTP/1.1\r\nHost : localhost\r\n\r\n")
+	require.Error(t, err)
 }
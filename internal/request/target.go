@@ -0,0 +1,314 @@
+package request
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type TargetForm int
+
+const (
+	TargetOriginForm TargetForm = iota
+	TargetAbsoluteForm
+	TargetAuthorityForm
+	TargetAsteriskForm
+)
+
+// URL is the parsed request-target. Path is percent-decoded and normalized,
+// RawPath and RawQuery hold the target exactly as it was received.
+type URL struct {
+	Form TargetForm
+	Scheme string
+	Host string
+	Path string
+	RawPath string
+	RawQuery string
+	Query Query
+}
+
+type Query map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (q Query) Get(key string) string {
+	values := q[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (q Query) Has(key string) bool {
+	_, exists := q[key]
+	return exists
+}
+
+// String returns the request-target for u in its form. A URL built in code
+// without RawPath is written with its Path percent-encoded.
+func (u *URL) String() string {
+	switch u.Form {
+	case TargetAsteriskForm:
+		return "*"
+	case TargetAuthorityForm:
+		return u.Host
+	}
+
+	target := u.RawPath
+	if target == "" {
+		target = escapePath(u.Path)
+	}
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	if u.Form == TargetAbsoluteForm {
+		target = u.Scheme + "://" + u.Host + target
+	}
+	return target
+}
+
+// ParseURL parses an absolute http or https URL, like the request-target of
+// a request to a proxy.
+func ParseURL(target string) (*URL, error) {
+	return parseAbsoluteForm(target)
+}
+
+func parseRequestTarget(method, target string) (*URL, error) {
+	for i := 0; i < len(target); i++ {
+		if c := target[i]; c <= ' ' || c == 0x7f {
+			return nil, fmt.Errorf("%w: invalid character %q", ErrInvalidRequestTarget, c)
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(target)
+	case target == "*":
+		if method != "OPTIONS" {
+			return nil, fmt.Errorf("%w: asterisk-form is only allowed for OPTIONS, got %s", ErrInvalidRequestTarget, method)
+		}
+		return &URL{
+			Form: TargetAsteriskForm,
+			Path: "*",
+			RawPath: "*",
+			Query: Query{},
+		}, nil
+	case strings.HasPrefix(target, "/"):
+		return parseOriginForm(target)
+	default:
+		return parseAbsoluteForm(target)
+	}
+}
+
+func parseOriginForm(target string) (*URL, error) {
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	return newURL(TargetOriginForm, "", "", rawPath, rawQuery)
+}
+
+func parseAbsoluteForm(target string) (*URL, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidRequestTarget, target)
+	}
+	scheme = strings.ToLower(scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("%w: unsupported scheme '%s'", ErrInvalidRequestTarget, scheme)
+	}
+
+	authorityEnd := strings.IndexAny(rest, "/?")
+	if authorityEnd == -1 {
+		authorityEnd = len(rest)
+	}
+	host := rest[:authorityEnd]
+	if err := validateHost(host, false); err != nil {
+		return nil, err
+	}
+
+	rawPath, rawQuery, _ := strings.Cut(rest[authorityEnd:], "?")
+	return newURL(TargetAbsoluteForm, scheme, host, rawPath, rawQuery)
+}
+
+func parseAuthorityForm(target string) (*URL, error) {
+	if err := validateHost(target, true); err != nil {
+		return nil, err
+	}
+	return &URL{
+		Form: TargetAuthorityForm,
+		Host: target,
+		Query: Query{},
+	}, nil
+}
+
+func newURL(form TargetForm, scheme, host, rawPath, rawQuery string) (*URL, error) {
+	path, err := normalizePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &URL{
+		Form: form,
+		Scheme: scheme,
+		Host: host,
+		Path: path,
+		RawPath: rawPath,
+		RawQuery: rawQuery,
+		Query: query,
+	}, nil
+}
+
+// validateHost checks a uri-host with an optional port. User info is not
+// allowed in http(s) URIs.
+func validateHost(authority string, portRequired bool) error {
+	if authority == "" {
+		return fmt.Errorf("%w: empty host", ErrInvalidRequestTarget)
+	}
+	if strings.Contains(authority, "@") {
+		return fmt.Errorf("%w: user info is not allowed", ErrInvalidRequestTarget)
+	}
+
+	host, port := authority, ""
+	if strings.HasPrefix(authority, "[") {
+		end := strings.Index(authority, "]")
+		if end == -1 {
+			return fmt.Errorf("%w: malformed IP literal '%s'", ErrInvalidRequestTarget, authority)
+		}
+		host = authority[:end + 1]
+		rest := authority[end + 1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return fmt.Errorf("%w: malformed host '%s'", ErrInvalidRequestTarget, authority)
+			}
+			port = rest[1:]
+		}
+	} else if i := strings.LastIndex(authority, ":"); i != -1 {
+		host, port = authority[:i], authority[i + 1:]
+	}
+
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrInvalidRequestTarget)
+	}
+	if strings.ContainsAny(host, "/?#") {
+		return fmt.Errorf("%w: malformed host '%s'", ErrInvalidRequestTarget, authority)
+	}
+	if port == "" {
+		if portRequired {
+			return fmt.Errorf("%w: missing port in '%s'", ErrInvalidRequestTarget, authority)
+		}
+		return nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 || strings.ContainsAny(port, "+-") {
+		return fmt.Errorf("%w: malformed port '%s'", ErrInvalidRequestTarget, port)
+	}
+	return nil
+}
+
+// normalizePath percent-decodes the path segment by segment, removes "." and
+// ".." segments and collapses duplicate slashes. A path escaping the root,
+// or containing an encoded slash or NUL, is rejected.
+func normalizePath(rawPath string) (string, error) {
+	if rawPath == "" {
+		return "/", nil
+	}
+
+	rawSegments := strings.Split(rawPath[1:], "/")
+	segments := make([]string, 0, len(rawSegments))
+	for i, rawSegment := range rawSegments {
+		isLast := i == len(rawSegments) - 1
+
+		segment, err := percentDecode(rawSegment, false)
+		if err != nil {
+			return "", err
+		}
+		if strings.ContainsAny(segment, "/\x00") {
+			return "", fmt.Errorf("%w: encoded slash or NUL in path", ErrInvalidRequestTarget)
+		}
+
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) == 0 {
+				return "", fmt.Errorf("%w: path escapes the root '%s'", ErrInvalidRequestTarget, rawPath)
+			}
+			segments = segments[:len(segments) - 1]
+		default:
+			segments = append(segments, segment)
+			continue
+		}
+
+		// keep the trailing slash of paths like "/a/" or "/a/b/..".
+		if isLast {
+			segments = append(segments, "")
+		}
+	}
+
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+func parseQuery(rawQuery string) (Query, error) {
+	query := Query{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := percentDecode(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := percentDecode(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		query[key] = append(query[key], value)
+	}
+	return query, nil
+}
+
+func percentDecode(s string, plusAsSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%':
+			if i + 2 >= len(s) || !isHexDigit(rune(s[i + 1])) || !isHexDigit(rune(s[i + 2])) {
+				return "", fmt.Errorf("%w: malformed percent-encoding '%s'", ErrInvalidRequestTarget, s)
+			}
+			value, _ := strconv.ParseUint(s[i + 1:i + 3], 16, 8)
+			decoded.WriteByte(byte(value))
+			i += 2
+		case c == '+' && plusAsSpace:
+			decoded.WriteByte(' ')
+		default:
+			decoded.WriteByte(c)
+		}
+	}
+	return decoded.String(), nil
+}
+
+func isHexDigit(r rune) bool {
+	return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+}
+
+// escapePath percent-encodes every byte of path that may not appear in a
+// path segment as is.
+func escapePath(path string) string {
+	const allowed = "-._~!$&'()*+,;=:@/"
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte(allowed, c) != -1 {
+			escaped.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,285 @@
+package request
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+// writeChunkSize is the largest chunk written for bodies of unknown length.
+const writeChunkSize = 32 * 1024
+
+// WriteOptions control how header fields are written by WriteToWithOptions.
+type WriteOptions struct {
+	// PreserveHeaderOrder writes the fields in the order they were received
+	// or added, instead of Host first and the rest sorted by name.
+	PreserveHeaderOrder bool
+	// PreserveHeaderCase writes the field names as they were received or
+	// added, instead of in their canonical form.
+	PreserveHeaderCase bool
+}
+
+// WriteTo writes the request as HTTP/1.1 with canonical header names and
+// order. It implements io.WriterTo.
+func (r *Request) WriteTo(w io.Writer) (int64, error) {
+	return r.WriteToWithOptions(w, WriteOptions{})
+}
+
+// WriteToWithOptions writes the request line, the header fields and the body
+// to w. Framing headers are replaced to match the body: a body announced with
+// Content-Length is written with exactly that many bytes, any other body is
+// chunked and followed by the trailers. Body is read to the end.
+func (r *Request) WriteToWithOptions(w io.Writer, options WriteOptions) (int64, error) {
+	counter := &countingWriter{writer: w}
+	out := bufio.NewWriter(counter)
+
+	requestLine, err := r.outgoingRequestLine()
+	if err != nil {
+		return 0, err
+	}
+	framing, body, err := r.outgoingFraming()
+	if err != nil {
+		return 0, err
+	}
+	fields, err := r.outgoingFields(framing, options)
+	if err != nil {
+		return 0, err
+	}
+
+	out.WriteString(requestLine)
+	if err := writeFields(out, fields); err != nil {
+		return counter.n, err
+	}
+
+	switch {
+	case framing.chunked:
+		err = r.writeChunked(out, body, options)
+	case framing.contentLength > 0:
+		_, err = io.CopyN(out, body, framing.contentLength)
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("body is shorter than its Content-Length of %d: %w", framing.contentLength, io.ErrUnexpectedEOF)
+		}
+	}
+	if err != nil {
+		out.Flush()
+		return counter.n, err
+	}
+
+	err = out.Flush()
+	return counter.n, err
+}
+
+// outgoingFraming describes how the body of an outgoing request is framed.
+type outgoingFraming struct {
+	chunked bool
+	// contentLength is -1 for requests without a body.
+	contentLength int64
+}
+
+func (f outgoingFraming) field() (headers.Field, bool) {
+	switch {
+	case f.chunked:
+		return headers.Field{Name: "Transfer-Encoding", Value: "chunked"}, true
+	case f.contentLength >= 0:
+		return headers.Field{Name: "Content-Length", Value: strconv.FormatInt(f.contentLength, 10)}, true
+	}
+	return headers.Field{}, false
+}
+
+// outgoingRequestLine builds the request line and checks it with the strict
+// parser, so the method and target cannot inject anything.
+func (r *Request) outgoingRequestLine() (string, error) {
+	method := r.RequestLine.Method
+	if method == "" {
+		method = "GET"
+	}
+	target := r.RequestLine.RequestTarget
+	if target == "" {
+		target = "/"
+		if r.URL != nil {
+			target = r.URL.String()
+		}
+	}
+
+	line := fmt.Sprintf("%s %s HTTP/1.1", method, target)
+	if _, err := parseRequestLine(line, StrictParsing); err != nil {
+		return "", err
+	}
+	if _, err := parseRequestTarget(method, target); err != nil {
+		return "", err
+	}
+	return line + "\r\n", nil
+}
+
+// outgoingFraming decides how the body is framed. Without a Content-Length,
+// the body is chunked unless it turns out to be empty.
+func (r *Request) outgoingFraming() (outgoingFraming, io.Reader, error) {
+	if contentLengths := r.Headers.Values("Content-Length"); len(contentLengths) > 0 {
+		contentLength, err := framing.ParseContentLength(contentLengths)
+		if err != nil {
+			return outgoingFraming{}, nil, err
+		}
+		if contentLength > 0 && r.Body == nil {
+			return outgoingFraming{}, nil, fmt.Errorf("body is shorter than its Content-Length of %d: %w", contentLength, io.ErrUnexpectedEOF)
+		}
+		return outgoingFraming{contentLength: int64(contentLength)}, r.Body, nil
+	}
+	if transferEncodings := r.Headers.Values("Transfer-Encoding"); len(transferEncodings) > 0 {
+		if err := validateTransferEncoding(transferEncodings); err != nil {
+			return outgoingFraming{}, nil, err
+		}
+		return outgoingFraming{chunked: true}, r.Body, nil
+	}
+
+	noBody := outgoingFraming{contentLength: -1}
+	switch r.RequestLine.Method {
+	case "POST", "PUT", "PATCH":
+		// servers may require a length for methods that usually carry a
+		// body (RFC 9110, section 8.6).
+		noBody.contentLength = 0
+	}
+	if r.Body == nil {
+		return noBody, nil, nil
+	}
+
+	// peeking fills the buffer with a single read, so the first chunk is
+	// as large as the data that is already available.
+	body := bufio.NewReaderSize(r.Body, writeChunkSize)
+	if _, err := body.Peek(1); errors.Is(err, io.EOF) {
+		return noBody, nil, nil
+	} else if err != nil {
+		return outgoingFraming{}, nil, err
+	}
+	return outgoingFraming{chunked: true}, body, nil
+}
+
+// outgoingFields returns the header fields to write: the request headers with
+// the framing headers replaced and Host added from the URL if it is missing.
+func (r *Request) outgoingFields(framing outgoingFraming, options WriteOptions) ([]headers.Field, error) {
+	framingField, hasFraming := framing.field()
+
+	var fields []headers.Field
+	hasHost := false
+	for _, field := range r.Headers.Fields() {
+		switch {
+		case strings.EqualFold(field.Name, "Content-Length"), strings.EqualFold(field.Name, "Transfer-Encoding"):
+			// the replacement takes the place of the first framing field.
+			if hasFraming {
+				if strings.EqualFold(field.Name, framingField.Name) {
+					framingField.Name = field.Name
+				}
+				fields = append(fields, framingField)
+				hasFraming = false
+			}
+			continue
+		case strings.EqualFold(field.Name, "Host"):
+			hasHost = true
+		}
+		fields = append(fields, field)
+	}
+	if hasFraming {
+		fields = append(fields, framingField)
+	}
+	if !hasHost && r.URL != nil && r.URL.Host != "" {
+		fields = slices.Insert(fields, 0, headers.Field{Name: "Host", Value: r.URL.Host})
+	}
+
+	return prepareFields(fields, options)
+}
+
+// prepareFields validates fields and applies the case and order options.
+func prepareFields(fields []headers.Field, options WriteOptions) ([]headers.Field, error) {
+	for i, field := range fields {
+		if err := headers.ValidateField(field.Name, field.Value); err != nil {
+			return nil, fmt.Errorf("field '%s': %w", field.Name, err)
+		}
+		if !options.PreserveHeaderCase {
+			fields[i].Name = headers.CanonicalName(field.Name)
+		}
+	}
+	if !options.PreserveHeaderOrder {
+		slices.SortStableFunc(fields, compareFields)
+	}
+	return fields, nil
+}
+
+// compareFields orders Host first and all other fields by name. Fields with
+// the same name keep their order.
+func compareFields(a, b headers.Field) int {
+	aHost, bHost := strings.EqualFold(a.Name, "Host"), strings.EqualFold(b.Name, "Host")
+	switch {
+	case aHost && bHost:
+		return 0
+	case aHost:
+		return -1
+	case bHost:
+		return 1
+	}
+	return strings.Compare(headers.CanonicalName(a.Name), headers.CanonicalName(b.Name))
+}
+
+func writeFields(w *bufio.Writer, fields []headers.Field) error {
+	for _, field := range fields {
+		if _, err := fmt.Fprintf(w, "%s: %s\r\n", field.Name, field.Value); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+// writeChunked writes body in chunks, followed by the last chunk and the
+// trailers, which are complete once body was read to the end.
+func (r *Request) writeChunked(w *bufio.Writer, body io.Reader, options WriteOptions) error {
+	if body != nil {
+		buffer := make([]byte, writeChunkSize)
+		for {
+			n, err := body.Read(buffer)
+			if n > 0 {
+				fmt.Fprintf(w, "%x\r\n", n)
+				w.Write(buffer[:n])
+				if _, err := w.WriteString("\r\n"); err != nil {
+					return err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := w.WriteString("0\r\n"); err != nil {
+		return err
+	}
+
+	var trailers []headers.Field
+	if r.Trailers != nil {
+		trailers = r.Trailers.Fields()
+	}
+	trailers, err := prepareFields(trailers, options)
+	if err != nil {
+		return err
+	}
+	return writeFields(w, trailers)
+}
+
+// countingWriter counts the bytes that reached the underlying writer.
+type countingWriter struct {
+	writer io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,105 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRequest(t *testing.T, r *Request, options WriteOptions) string {
+	var out strings.Builder
+	n, err := r.WriteToWithOptions(&out, options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+	return out.String()
+}
+
+func TestWriteTo(t *testing.T) {
+	read := func(raw string) *Request {
+		r, err := RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		return r
+	}
+
+	// Test: Headers are written canonical, with Host first
+	r := read("GET /coffee?cups=2 HTTP/1.1\r\nuser-agent: curl/7.81.0\r\naccept: */*\r\nhost: localhost:42069\r\nx-b: 1\r\nX-A: 2\r\nx-b: 3\r\n\r\n")
+	assert.Equal(t, "GET /coffee?cups=2 HTTP/1.1\r\nHost: localhost:42069\r\nAccept: */*\r\nUser-Agent: curl/7.81.0\r\nX-A: 2\r\nX-B: 1\r\nX-B: 3\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+
+	// Test: Received order and casing are preserved
+	r = read("GET / HTTP/1.1\r\nuser-agent: curl/7.81.0\r\nhost: localhost\r\nX-custom: a\r\n\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\nuser-agent: curl/7.81.0\r\nhost: localhost\r\nX-custom: a\r\n\r\n", writeRequest(t, r, WriteOptions{PreserveHeaderOrder: true, PreserveHeaderCase: true}))
+
+	// Test: HTTP/1.0 requests are written as HTTP/1.1
+	r = read("GET / HTTP/1.0\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+
+	// Test: Content-Length bodies keep their framing
+	r = read("POST /submit HTTP/1.1\r\nHost: localhost\r\ncontent-length: 5\r\nX-After: 1\r\n\r\nhello")
+	assert.Equal(t, "POST /submit HTTP/1.1\r\nHost: localhost\r\ncontent-length: 5\r\nX-After: 1\r\n\r\nhello", writeRequest(t, r, WriteOptions{PreserveHeaderOrder: true, PreserveHeaderCase: true}))
+
+	// Test: Chunked bodies keep their chunks and trailers
+	r = read("POST /submit HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n3;ext=1\r\nhel\r\n2\r\nlo\r\n0\r\nx-checksum: abc\r\n\r\n")
+	assert.Equal(t, "POST /submit HTTP/1.1\r\nHost: localhost\r\nTrailer: X-Checksum\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhel\r\n2\r\nlo\r\n0\r\nX-Checksum: abc\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+
+	// Test: Requests without a body
+	r = read("DELETE /item/1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "DELETE /item/1 HTTP/1.1\r\nHost: localhost\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+}
+
+func TestWriteToBuiltRequest(t *testing.T) {
+	// Test: The target and Host are taken from the URL, bodies of unknown
+	// length are chunked
+	h := headers.NewHeaders()
+	h.Add("Content-Type", "text/plain")
+	r := &Request{
+		RequestLine: RequestLine{Method: "PUT"},
+		URL: &URL{Host: "example.com:8080", Path: "/a file", RawQuery: "b=c"},
+		Headers: h,
+		Body: io.NopCloser(strings.NewReader("hello")),
+	}
+	assert.Equal(t, "PUT /a%20file?b=c HTTP/1.1\r\nHost: example.com:8080\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+
+	// Test: Empty bodies of POST requests are announced
+	r = &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/submit"},
+		Headers: headers.NewHeaders(),
+		Body: io.NopCloser(strings.NewReader("")),
+	}
+	assert.Equal(t, "POST /submit HTTP/1.1\r\nContent-Length: 0\r\n\r\n", writeRequest(t, r, WriteOptions{}))
+
+	// Test: A request without anything set is a GET for /
+	assert.Equal(t, "GET / HTTP/1.1\r\n\r\n", writeRequest(t, &Request{}, WriteOptions{}))
+}
+
+func TestWriteToErrors(t *testing.T) {
+	write := func(r *Request) error {
+		_, err := r.WriteTo(io.Discard)
+		return err
+	}
+
+	// Test: Line breaks in values cannot inject fields
+	h := headers.NewHeaders()
+	h.Add("X-Custom", "a\r\nX-Injected: true")
+	require.ErrorIs(t, write(&Request{Headers: h}), headers.ErrInvalidHeaderValue)
+
+	// Test: Invalid field names
+	h = headers.NewHeaders()
+	h.Add("X Custom", "a")
+	require.ErrorIs(t, write(&Request{Headers: h}), headers.ErrInvalidHeaderName)
+
+	// Test: Invalid request line
+	err := write(&Request{RequestLine: RequestLine{Method: "GET", RequestTarget: "/ HTTP/1.1\r\nX-Injected: true\r\n"}})
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+	err = write(&Request{RequestLine: RequestLine{Method: "GET /admin", RequestTarget: "/"}})
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+
+	// Test: Body shorter than its Content-Length
+	h = headers.NewHeaders()
+	h.Set("Content-Length", "10")
+	err = write(&Request{RequestLine: RequestLine{Method: "POST", RequestTarget: "/"}, Headers: h, Body: io.NopCloser(strings.NewReader("short"))})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
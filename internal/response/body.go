@@ -0,0 +1,68 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+)
+
+// body is the Response.Body handed to callers.
+type body struct {
+	response *Response
+	framed *framing.Body
+	err error
+	closed bool
+}
+
+func newBody(reader *framing.Reader, response *Response) *body {
+	b := &body{response: response}
+	switch {
+	case response.chunked:
+		b.framed = framing.NewChunkedBody(reader, response.Trailers, framing.BodyOptions{
+			ParseTrailer: response.parseHeaderLine,
+		})
+	case response.untilClose:
+		b.framed = framing.NewUntilCloseBody(reader)
+	default:
+		b.framed = framing.NewLengthBody(reader, response.contentLength)
+	}
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.framed.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = bodyError(err)
+		return n, b.err
+	}
+	return n, err
+}
+
+// Close stops the caller from reading any further. Unread data stays on the
+// connection, so the response must be discarded before the next one is read.
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// bodyError unwraps framing errors, as offsets in responses are of no use
+// to anyone, and reports bodies cut short as incomplete responses.
+func bodyError(err error) error {
+	var framingErr *framing.Error
+	if !errors.As(err, &framingErr) {
+		return err
+	}
+	if errors.Is(framingErr.Err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrIncompleteResponse, io.ErrUnexpectedEOF)
+	}
+	return framingErr.Err
+}
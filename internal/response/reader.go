@@ -0,0 +1,366 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/framing"
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+)
+
+var (
+	ErrMalformedStatusLine = errors.New("Malformed status line")
+	ErrUnsupportedVersion = errors.New("Unsupported HTTP version")
+	ErrStatusLineTooLong = errors.New("Status line too long")
+	ErrHeaderTooLarge = errors.New("Response header fields too large")
+	ErrIncompleteResponse = errors.New("Incomplete response")
+	ErrBodyClosed = errors.New("Read on closed response body")
+	ErrTooManyInterimResponses = errors.New("Too many interim responses")
+)
+
+// Responses come from servers we chose to talk to, so they get fixed limits
+// that only protect against runaway input.
+const (
+	maxStatusLineBytes = 8 * 1024
+	maxHeaderBytes = 1024 * 1024
+	maxInterimResponses = 16
+)
+
+type responseState int
+
+const (
+	responseStateParsingStatusLine responseState = iota
+	responseStateParsingHeaders
+	responseStateParsingDone
+)
+
+type Response struct {
+	state responseState
+	// Interim holds the 1xx responses received before this one, like
+	// 103 Early Hints.
+	Interim []Interim
+	StatusLine StatusLine
+	Headers *headers.Headers
+	// Body streams the response body from the connection. Trailers are only
+	// populated once Body has been read to the end.
+	Body io.ReadCloser
+	Trailers *headers.Headers
+	body *body
+	chunked bool
+	untilClose bool
+	contentLength int
+	headerBytes int
+	requestMethod string
+}
+
+type StatusLine struct {
+	HttpVersion string
+	StatusCode StatusCode
+	ReasonPhrase string
+}
+
+// Interim is an informational 1xx response, which has no body.
+type Interim struct {
+	StatusLine StatusLine
+	Headers *headers.Headers
+}
+
+// Reader reads consecutive responses from a persistent connection.
+type Reader struct {
+	reader *framing.Reader
+	current *Response
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: framing.NewReader(reader),
+	}
+}
+
+// ResponseFromReader reads a single response to a GET request from reader.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	return NewReader(reader).ReadResponse()
+}
+
+// ReadResponse reads the next response, which answers a GET request.
+func (r *Reader) ReadResponse() (*Response, error) {
+	return r.ReadResponseTo("GET")
+}
+
+// ReadResponseTo reads the status line and headers of the next final
+// response, skipping any 1xx responses before it. The request method decides
+// whether the response can have a body. The body of the previous response
+// must have been read to the end before. io.EOF is returned if the reader is
+// exhausted before any byte of a new response was received.
+func (r *Reader) ReadResponseTo(requestMethod string) (*Response, error) {
+	if r.current != nil && !r.current.body.framed.Done() {
+		return nil, fmt.Errorf("Previous response body has not been fully read")
+	}
+
+	response := &Response{
+		state: responseStateParsingStatusLine,
+		Headers: headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		requestMethod: requestMethod,
+	}
+
+	for response.parsingHead() {
+		bytesParsed, err := response.parse(r.reader.Buffered())
+		if err != nil {
+			return nil, err
+		}
+		r.reader.Consume(bytesParsed)
+
+		if !response.parsingHead() {
+			break
+		}
+
+		bytesRead, err := r.reader.Fill()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if bytesRead > 0 {
+				continue
+			}
+			if response.state == responseStateParsingStatusLine && len(response.Interim) == 0 && len(r.reader.Buffered()) == 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("%w: %w", ErrIncompleteResponse, io.ErrUnexpectedEOF)
+		}
+	}
+
+	response.body = newBody(r.reader, response)
+	response.Body = response.body
+	r.current = response
+	return response, nil
+}
+
+// KeepAlive reports whether the server allows the connection to be reused
+// after this response. Bodies delimited by closing the connection never
+// allow that, and neither do connections switched to another protocol or
+// turned into a tunnel.
+func (r *Response) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") || r.untilClose || r.switchesProtocol() {
+		return false
+	}
+	if r.StatusLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// DiscardBody reads and drops up to limit bytes of the unread body. It
+// reports whether the end of the body was reached, which is required to
+// read the next response from the same connection.
+func (r *Response) DiscardBody(limit int) bool {
+	if r.body == nil {
+		return false
+	}
+	return r.body.framed.Discard(limit)
+}
+
+func (r *Response) parsingHead() bool {
+	return r.state == responseStateParsingStatusLine || r.state == responseStateParsingHeaders
+}
+
+func (r *Response) parse(next []byte) (int, error) {
+	totalBytesParsed := 0
+	for r.parsingHead() {
+		n, err := r.parseSingle(next[totalBytesParsed:])
+		if err != nil {
+			return totalBytesParsed, err
+		}
+
+		totalBytesParsed += n
+		if n == 0 {
+			break
+		}
+	}
+
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(next []byte) (int, error) {
+	switch r.state {
+	case responseStateParsingStatusLine:
+		line, n, err := headers.FindLine(next, false)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			if len(next) > maxStatusLineBytes {
+				return 0, ErrStatusLineTooLong
+			}
+			return 0, nil
+		}
+		if len(line) > maxStatusLineBytes {
+			return 0, ErrStatusLineTooLong
+		}
+
+		statusLine, err := parseStatusLine(string(line))
+		if err != nil {
+			return 0, err
+		}
+		r.StatusLine = *statusLine
+		r.state = responseStateParsingHeaders
+		return n, nil
+	case responseStateParsingHeaders:
+		n, done, err := r.parseHeaderLine(r.Headers, next)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+	case responseStateParsingDone:
+		return 0, fmt.Errorf("Cannot parse in a done state")
+	default:
+		return 0, fmt.Errorf("Unknown state")
+	}
+}
+
+// parseHeaderLine parses a single header or trailer line into h, enforcing
+// the header limit before the line is complete.
+func (r *Response) parseHeaderLine(h *headers.Headers, next []byte) (int, bool, error) {
+	n, done, err := h.Parse(next)
+	if err != nil {
+		return 0, false, err
+	}
+	if n == 0 {
+		if r.headerBytes + len(next) > maxHeaderBytes {
+			return 0, false, ErrHeaderTooLarge
+		}
+		return 0, false, nil
+	}
+
+	r.headerBytes += n
+	if r.headerBytes > maxHeaderBytes {
+		return 0, false, ErrHeaderTooLarge
+	}
+	return n, done, nil
+}
+
+// switchesProtocol reports whether the connection no longer carries HTTP
+// after this response.
+func (r *Response) switchesProtocol() bool {
+	statusCode := r.StatusLine.StatusCode
+	if statusCode == StatusSwitchingProtocols {
+		return true
+	}
+	return r.requestMethod == "CONNECT" && statusCode >= 200 && statusCode < 300
+}
+
+// hasBody reports whether the response can have a body at all, whatever its
+// headers say (RFC 9112, section 6.3).
+func (r *Response) hasBody() bool {
+	statusCode := r.StatusLine.StatusCode
+	switch {
+	case r.requestMethod == "HEAD", statusCode < 200, statusCode == StatusNoContent, statusCode == StatusNotModified:
+		return false
+	}
+	return !r.switchesProtocol()
+}
+
+// startBody determines how the body is framed once all headers are parsed.
+// Unlike requests, responses without Content-Length or chunked encoding are
+// delimited by the server closing the connection (RFC 9112, section 6.3).
+func (r *Response) startBody() error {
+	if statusCode := r.StatusLine.StatusCode; statusCode < 200 && statusCode != StatusSwitchingProtocols {
+		return r.startNextResponse()
+	}
+	r.state = responseStateParsingDone
+	if !r.hasBody() {
+		return nil
+	}
+
+	if transferEncodings := r.Headers.Values("Transfer-Encoding"); len(transferEncodings) > 0 {
+		// Transfer-Encoding overrides Content-Length. Without chunked as the
+		// final coding, the end of the body is the end of the connection.
+		codings := strings.Split(strings.Join(transferEncodings, ","), ",")
+		if headers.EqualFold(strings.TrimSpace(codings[len(codings) - 1]), "chunked") {
+			r.chunked = true
+		} else {
+			r.untilClose = true
+		}
+		return nil
+	}
+
+	contentLengths := r.Headers.Values("Content-Length")
+	if len(contentLengths) == 0 {
+		r.untilClose = true
+		return nil
+	}
+
+	contentLength, err := framing.ParseContentLength(contentLengths)
+	if err != nil {
+		return err
+	}
+	r.contentLength = contentLength
+	return nil
+}
+
+// startNextResponse keeps the 1xx response that was just parsed and starts
+// parsing the response that follows it.
+func (r *Response) startNextResponse() error {
+	if len(r.Interim) == maxInterimResponses {
+		return ErrTooManyInterimResponses
+	}
+	r.Interim = append(r.Interim, Interim{
+		StatusLine: r.StatusLine,
+		Headers: r.Headers,
+	})
+	r.StatusLine = StatusLine{}
+	r.Headers = headers.NewHeaders()
+	r.state = responseStateParsingStatusLine
+	return nil
+}
+
+// parseStatusLine parses a status line without its line ending. The reason
+// phrase may be empty, and some servers leave out the space before it.
+func parseStatusLine(line string) (*StatusLine, error) {
+	version, rest, found := strings.Cut(line, " ")
+	if !found {
+		return nil, fmt.Errorf("%w: '%s'", ErrMalformedStatusLine, line)
+	}
+	code, reason, _ := strings.Cut(rest, " ")
+
+	versionNumber, found := strings.CutPrefix(version, "HTTP/")
+	if !found {
+		return nil, fmt.Errorf("%w: '%s'", ErrMalformedStatusLine, line)
+	}
+	if versionNumber != "1.0" && versionNumber != "1.1" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+
+	if len(code) != 3 {
+		return nil, fmt.Errorf("%w: status code '%s'", ErrMalformedStatusLine, code)
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return nil, fmt.Errorf("%w: status code '%s'", ErrMalformedStatusLine, code)
+		}
+	}
+	statusCode, _ := strconv.Atoi(code)
+	if statusCode < 100 {
+		return nil, fmt.Errorf("%w: status code '%s'", ErrMalformedStatusLine, code)
+	}
+
+	for _, r := range reason {
+		if r != '\t' && (r < ' ' || r == 0x7f) {
+			return nil, fmt.Errorf("%w: invalid character %q in reason phrase", ErrMalformedStatusLine, r)
+		}
+	}
+
+	return &StatusLine{
+		HttpVersion: versionNumber,
+		StatusCode: StatusCode(statusCode),
+		ReasonPhrase: reason,
+	}, nil
+}
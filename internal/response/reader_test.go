@@ -0,0 +1,205 @@
+package response
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oneByteReader returns data one byte per read, to split every element of a
+// response across reads.
+type oneByteReader struct {
+	data string
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func readBody(t *testing.T, r *Response) string {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestResponseFromReader(t *testing.T) {
+	// Test: Content-Length body
+	r, err := ResponseFromReader(&oneByteReader{data: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusLine{HttpVersion: "1.1", StatusCode: StatusOK, ReasonPhrase: "OK"}, r.StatusLine)
+	value, _ := r.Headers.Get("Content-Type")
+	assert.Equal(t, "text/plain", value)
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Chunked body with trailers
+	r, err = ResponseFromReader(&oneByteReader{data: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3;ext=1\r\nhel\r\n2\r\nlo\r\n0\r\nX-Checksum: abc\r\n\r\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readBody(t, r))
+	value, _ = r.Trailers.Get("X-Checksum")
+	assert.Equal(t, "abc", value)
+
+	// Test: Body delimited by closing the connection
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\n\r\nuntil the end"))
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", readBody(t, r))
+	assert.False(t, r.KeepAlive())
+
+	// Test: Transfer codings without chunked are read until close
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\nContent-Length: 2\r\n\r\ncompressed"))
+	require.NoError(t, err)
+	assert.Equal(t, "compressed", readBody(t, r))
+
+	// Test: Empty reason phrase, with and without the space
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 204 \r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusNoContent, r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 299\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(299), r.StatusLine.StatusCode)
+
+	// Test: HTTP/1.0 responses need keep-alive to be persistent
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+}
+
+func TestReadResponsePipelined(t *testing.T) {
+	reader := NewReader(&oneByteReader{data: "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none" +
+		"HTTP/1.1 404 Not Found\r\nTransfer-Encoding: chunked\r\n\r\n3\r\ntwo\r\n0\r\n\r\n"})
+
+	r, err := reader.ReadResponse()
+	require.NoError(t, err)
+	// the next response can only be read after the body.
+	_, err = reader.ReadResponse()
+	require.Error(t, err)
+	assert.Equal(t, "one", readBody(t, r))
+
+	r, err = reader.ReadResponse()
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, r.StatusLine.StatusCode)
+	assert.Equal(t, "two", readBody(t, r))
+
+	_, err = reader.ReadResponse()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestInterimResponses(t *testing.T) {
+	// Test: 1xx responses before the final one are kept
+	r, err := ResponseFromReader(&oneByteReader{data: "HTTP/1.1 100 Continue\r\n\r\n" +
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusOK, r.StatusLine.StatusCode)
+	require.Len(t, r.Interim, 2)
+	assert.Equal(t, StatusContinue, r.Interim[0].StatusLine.StatusCode)
+	assert.Equal(t, StatusEarlyHints, r.Interim[1].StatusLine.StatusCode)
+	link, _ := r.Interim[1].Headers.Get("Link")
+	assert.Equal(t, "</style.css>; rel=preload", link)
+	_, found := r.Headers.Get("Link")
+	assert.False(t, found)
+	assert.Equal(t, "ok", readBody(t, r))
+
+	// Test: Switching Protocols is the final response
+	reader := NewReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n\x81\x00"))
+	r, err = reader.ReadResponse()
+	require.NoError(t, err)
+	assert.Equal(t, StatusSwitchingProtocols, r.StatusLine.StatusCode)
+	assert.Equal(t, "", readBody(t, r))
+	assert.False(t, r.KeepAlive())
+
+	// Test: Endless interim responses
+	_, err = ResponseFromReader(strings.NewReader(strings.Repeat("HTTP/1.1 100 Continue\r\n\r\n", maxInterimResponses + 1)))
+	require.ErrorIs(t, err, ErrTooManyInterimResponses)
+
+	// Test: Connection closed after an interim response
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 100 Continue\r\n\r\n"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestResponsesWithoutBody(t *testing.T) {
+	tests := []struct {
+		name string
+		method string
+		head string
+		keepAlive bool
+	}{
+		{"HEAD", "HEAD", "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", true},
+		{"HEAD with chunked", "HEAD", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", true},
+		{"No Content", "GET", "HTTP/1.1 204 No Content\r\n\r\n", true},
+		{"Not Modified", "GET", "HTTP/1.1 304 Not Modified\r\nContent-Length: 5\r\n\r\n", true},
+		{"CONNECT tunnel", "CONNECT", "HTTP/1.1 200 Connection Established\r\n\r\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the next response directly follows the head.
+			reader := NewReader(&oneByteReader{data: test.head + "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nnext"})
+			r, err := reader.ReadResponseTo(test.method)
+			require.NoError(t, err)
+			assert.Equal(t, "", readBody(t, r))
+			assert.Equal(t, test.keepAlive, r.KeepAlive())
+
+			if !test.keepAlive {
+				return
+			}
+			r, err = reader.ReadResponse()
+			require.NoError(t, err)
+			assert.Equal(t, "next", readBody(t, r))
+		})
+	}
+
+	// Test: Responses to other methods keep their body
+	r, err := NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")).ReadResponseTo("POST")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readBody(t, r))
+}
+
+func TestResponseFromReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw string
+		err error
+	}{
+		{"missing status code", "HTTP/1.1\r\n\r\n", ErrMalformedStatusLine},
+		{"short status code", "HTTP/1.1 20 OK\r\n\r\n", ErrMalformedStatusLine},
+		{"status code below 100", "HTTP/1.1 099 Low\r\n\r\n", ErrMalformedStatusLine},
+		{"control character in reason", "HTTP/1.1 200 O\x00K\r\n\r\n", ErrMalformedStatusLine},
+		{"not http", "ICY 200 OK\r\n\r\n", ErrMalformedStatusLine},
+		{"unsupported version", "HTTP/2.0 200 OK\r\n\r\n", ErrUnsupportedVersion},
+		{"duplicate content length", "HTTP/1.1 200 OK\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n", request.ErrDuplicateContentLength},
+		{"incomplete head", "HTTP/1.1 200 OK\r\nContent-", io.ErrUnexpectedEOF},
+		{"status line too long", "HTTP/1.1 200 " + strings.Repeat("a", maxStatusLineBytes), ErrStatusLineTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ResponseFromReader(strings.NewReader(test.raw))
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+
+	// Test: Bodies ending early
+	r, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrIncompleteResponse)
+
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, request.ErrMalformedChunk)
+}
@@ -9,46 +9,67 @@ import (
 	"github.com/MrBhop/httpfromtcp/internal/headers"
 )
 
-type StatusCode int
+// GetStatusLine returns the status line for a registered status code.
+func GetStatusLine(statusCode StatusCode) ([]byte, error) {
+	reason := StatusText(statusCode)
+	if reason == "" {
+		return nil, fmt.Errorf("Unknown status code %d, use a custom reason phrase", statusCode)
+	}
+	return GetStatusLineWithReason(statusCode, reason)
+}
 
-const (
-	StatusOK StatusCode = 200
-	StatusBadRequest StatusCode= 400
-	StatusInternalServerError StatusCode = 500
-)
+// GetStatusLineWithReason returns a status line using the given reason phrase,
+// which allows sending unregistered status codes.
+func GetStatusLineWithReason(statusCode StatusCode, reason string) ([]byte, error) {
+	return GetVersionedStatusLine("1.1", statusCode, reason)
+}
 
-func GetStatusLine(statusCode StatusCode) []byte {
-	var statusLine string
-	switch statusCode {
-	case StatusOK:
-		statusLine = "OK"
-	case StatusBadRequest:
-		statusLine = "Bad Request"
-	case StatusInternalServerError:
-		statusLine = "Internal Server Error"
-	default:
-		return []byte{}
+// GetVersionedStatusLine returns a status line for the given HTTP version,
+// either "1.0" or "1.1".
+func GetVersionedStatusLine(httpVersion string, statusCode StatusCode, reason string) ([]byte, error) {
+	if httpVersion != "1.0" && httpVersion != "1.1" {
+		return nil, fmt.Errorf("Unsupported HTTP version %s", httpVersion)
+	}
+	if statusCode < 100 || statusCode > 999 {
+		return nil, fmt.Errorf("Status code must have 3 digits, got %d", statusCode)
+	}
+	for _, r := range reason {
+		if r != '\t' && (r < ' ' || r == 0x7f) {
+			return nil, fmt.Errorf("Invalid character in reason phrase: %q", r)
+		}
 	}
 
-	return fmt.Appendf([]byte{}, "HTTP/1.1 %d %s%s", statusCode, statusLine, constants.CrLf)
+	return fmt.Appendf([]byte{}, "HTTP/%s %d %s%s", httpVersion, statusCode, reason, constants.CrLf), nil
 }
 
 func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	_, err := w.Write(GetStatusLine(statusCode))
+	statusLine, err := GetStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(statusLine)
+	return err
+}
+
+func WriteStatusLineWithReason(w io.Writer, statusCode StatusCode, reason string) error {
+	statusLine, err := GetStatusLineWithReason(statusCode, reason)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(statusLine)
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	headers := headers.NewHeaders()
 	headers.Add("Content-Length", strconv.Itoa(contentLen))
-	headers.Add("Connection", "close")
 	headers.Add("Content-Type", "text/plain")
 	return headers
 }
 
-func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	for k, v := range headers {
-		_, err := w.Write([]byte(k + ": " + v + constants.CrLf))
+func WriteHeaders(w io.Writer, headers *headers.Headers) error {
+	for _, field := range headers.Fields() {
+		_, err := w.Write([]byte(field.Name + ": " + field.Value + constants.CrLf))
 		if err != nil {
 			return err
 		}
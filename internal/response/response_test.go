@@ -0,0 +1,188 @@
+package response
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStatusLine(t *testing.T) {
+	// Test: Registered status codes
+	statusLine, err := GetStatusLine(StatusOK)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", string(statusLine))
+
+	statusLine, err = GetStatusLine(StatusTooManyRequests)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 429 Too Many Requests\r\n", string(statusLine))
+
+	statusLine, err = GetStatusLine(StatusContentTooLarge)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\n", string(statusLine))
+
+	// Test: Unknown status code
+	statusLine, err = GetStatusLine(StatusCode(299))
+	require.Error(t, err)
+	assert.Empty(t, statusLine)
+
+	// Test: Custom status code with reason phrase
+	statusLine, err = GetStatusLineWithReason(StatusCode(299), "Mostly Fine")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 299 Mostly Fine\r\n", string(statusLine))
+
+	// Test: Empty reason phrase
+	statusLine, err = GetStatusLineWithReason(StatusNoContent, "")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 \r\n", string(statusLine))
+
+	// Test: Invalid custom status lines
+	_, err = GetStatusLineWithReason(StatusCode(42), "Too Short")
+	require.Error(t, err)
+	_, err = GetStatusLineWithReason(StatusCode(1000), "Too Long")
+	require.Error(t, err)
+	_, err = GetStatusLineWithReason(StatusOK, "OK\r\nX-Injected: true")
+	require.Error(t, err)
+}
+
+func TestGetVersionedStatusLine(t *testing.T) {
+	statusLine, err := GetVersionedStatusLine("1.0", StatusOK, "OK")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n", string(statusLine))
+
+	statusLine, err = GetVersionedStatusLine("1.1", StatusNotFound, "Not Found")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", string(statusLine))
+
+	_, err = GetVersionedStatusLine("2.0", StatusOK, "OK")
+	require.Error(t, err)
+}
+
+func TestWriterHTTP10(t *testing.T) {
+	write := func(version string, handler func(w *Writer)) (string, *Writer) {
+		server, client := net.Pipe()
+		w := NewWriter(server)
+		w.SetRequestVersion(version)
+		done := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(client)
+			done <- data
+		}()
+		handler(w)
+		server.Close()
+		return string(<-done), w
+	}
+
+	// Test: Chunked responses are sent close-delimited to HTTP/1.0 clients
+	out, w := write("1.0", func(w *Writer) {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Checksum")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, w.WriteChunkedBodyDone(false))
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Checksum", "abc")
+		require.NoError(t, w.WriteTrailers(trailers))
+	})
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello", out)
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, 5, w.BytesWritten())
+
+	// Test: Persistent HTTP/1.0 responses announce keep-alive
+	out, w = write("1.0", func(w *Writer) {
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		h := headers.NewHeaders()
+		h.Set("Content-Length", "2")
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteBody([]byte("ok"))
+		require.NoError(t, err)
+	})
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.0 200 OK\r\n"))
+	assert.Contains(t, out, "\r\nConnection: keep-alive\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nok"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: HTTP/1.1 responses are unchanged
+	out, w = write("1.1", func(w *Writer) {
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteChunkedBody([]byte("ok"))
+		require.NoError(t, err)
+		require.NoError(t, w.WriteChunkedBodyDone(true))
+	})
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n", out)
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterHead(t *testing.T) {
+	write := func(handler func(w *Writer)) (string, *Writer) {
+		server, client := net.Pipe()
+		w := NewWriter(server)
+		w.SetRequestMethod("HEAD")
+		done := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(client)
+			done <- data
+		}()
+		handler(w)
+		server.Close()
+		return string(<-done), w
+	}
+
+	// Test: The body is discarded, the headers are kept
+	out, w := write(func(w *Writer) {
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+		n, err := w.WriteBody([]byte("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+	})
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", out)
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, 0, w.BytesWritten())
+
+	// Test: Chunked bodies and trailers are discarded
+	out, w = write(func(w *Writer) {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		_, err := w.WriteChunkedBody([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, w.WriteChunkedBodyDone(false))
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Checksum", "abc")
+		require.NoError(t, w.WriteTrailers(trailers))
+	})
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", out)
+	assert.True(t, w.KeepAlive())
+
+	// Test: Headers without a body need no framing
+	out, w = write(func(w *Writer) {
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	})
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n\r\n", out)
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteHeaders(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Add("Content-Type", "text/html")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Add("X-Custom", "value")
+
+	var out strings.Builder
+	require.NoError(t, WriteHeaders(&out, h))
+	assert.Equal(t, "Content-Type: text/html\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\nX-Custom: value\r\n\r\n", out.String())
+}
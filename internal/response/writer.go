@@ -3,6 +3,7 @@ package response
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/MrBhop/httpfromtcp/internal/constants"
 	"github.com/MrBhop/httpfromtcp/internal/headers"
@@ -19,29 +20,185 @@ const (
 type Writer struct {
 	writerState WriterState
 	Connection net.Conn
+	closeConnection bool
+	contentLength int
+	bodyBytesWritten int
+	chunked bool
+	chunkedDone bool
+	statusCode StatusCode
+	bytesWritten int
+	extraHeaders *headers.Headers
+	httpVersion string
+	unframed bool
+	discardBody bool
+}
+
+func NewWriter(conn net.Conn) *Writer {
+	return &Writer{
+		Connection: conn,
+		httpVersion: "1.1",
+	}
+}
+
+// SetRequestVersion sets the HTTP version of the request being answered. The
+// status line echoes it, and HTTP/1.0 clients get close-delimited bodies
+// instead of chunked ones since they do not understand chunked encoding.
+func (w *Writer) SetRequestVersion(httpVersion string) {
+	if httpVersion == "1.0" {
+		w.httpVersion = "1.0"
+		return
+	}
+	w.httpVersion = "1.1"
+}
+
+// SetRequestMethod sets the method of the request being answered. Responses
+// to HEAD have no body, so body writes are discarded after the headers, which
+// lets GET handlers answer HEAD requests as well.
+func (w *Writer) SetRequestMethod(method string) {
+	w.discardBody = method == "HEAD"
+}
+
+func (w *Writer) State() WriterState {
+	return w.writerState
+}
+
+// StatusCode returns the status code that was written, or 0 if the status
+// line was not written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// the framing of chunked bodies.
+func (w *Writer) BytesWritten() int {
+	return w.bytesWritten
+}
+
+// AddHeader adds a header to be sent in addition to the ones passed to
+// WriteHeaders. Headers passed to WriteHeaders take precedence. This lets
+// middleware add headers to responses written by other handlers.
+func (w *Writer) AddHeader(key, value string) {
+	if w.extraHeaders == nil {
+		w.extraHeaders = headers.NewHeaders()
+	}
+	w.extraHeaders.Add(key, value)
+}
+
+// CloseAfterResponse marks the connection to be closed once the response has
+// been written. A "Connection: close" header is added to the response.
+func (w *Writer) CloseAfterResponse() {
+	w.closeConnection = true
+}
+
+// KeepAlive reports whether a complete, correctly framed response was written
+// and the connection can be reused for another request.
+func (w *Writer) KeepAlive() bool {
+	if w.closeConnection || w.writerState != WriterBody {
+		return false
+	}
+	if !w.hasBody() {
+		return true
+	}
+	if w.chunked {
+		return w.chunkedDone
+	}
+	return w.bodyBytesWritten == w.contentLength
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.writerState != WriterStatusLine {
 		return fmt.Errorf("Invalid operation in the current state")
 	}
-	if err := WriteStatusLine(w.Connection, statusCode); err != nil {
+	reason := StatusText(statusCode)
+	if reason == "" {
+		return fmt.Errorf("Unknown status code %d, use a custom reason phrase", statusCode)
+	}
+	return w.WriteStatusLineWithReason(statusCode, reason)
+}
+
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
+	if w.writerState != WriterStatusLine {
+		return fmt.Errorf("Invalid operation in the current state")
+	}
+	statusLine, err := GetVersionedStatusLine(w.httpVersion, statusCode, reason)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Connection.Write(statusLine); err != nil {
 		return err
 	}
+	w.statusCode = statusCode
 	w.writerState = WriterHeaders
 	return nil
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.writerState != WriterHeaders {
 		return fmt.Errorf("Invalid operation in the current state")
 	}
-	err := w.writeHeadersInternal(headers)
+	// collect first, so repeated extra headers are all added.
+	var extra []headers.Field
+	for _, field := range w.extraHeaders.Fields() {
+		if _, exists := h.Get(field.Name); !exists {
+			extra = append(extra, field)
+		}
+	}
+	for _, field := range extra {
+		h.Add(field.Name, field.Value)
+	}
+	w.prepareFraming(h)
+	err := w.writeHeadersInternal(h)
 	w.writerState = WriterBody
 	return err
 }
 
-func (w *Writer) writeHeadersInternal(headers headers.Headers) error {
+// prepareFraming records how the body is delimited. A response without
+// Content-Length or chunked encoding can only be ended by closing the
+// connection, so the connection is marked to be closed in that case. HTTP/1.0
+// clients do not understand chunked encoding, so chunked responses to them are
+// sent close-delimited instead.
+func (w *Writer) prepareFraming(headers *headers.Headers) {
+	w.chunked = headers.HasToken("Transfer-Encoding", "chunked")
+	if w.chunked && w.httpVersion == "1.0" {
+		w.chunked = false
+		w.unframed = true
+		w.closeConnection = true
+		headers.Remove("Transfer-Encoding")
+		headers.Remove("Trailer")
+		headers.Remove("Content-Length")
+	}
+	w.contentLength = -1
+	if contentLengthString, exists := headers.Get("Content-Length"); exists && !w.chunked {
+		if contentLength, err := strconv.Atoi(contentLengthString); err == nil && contentLength >= 0 {
+			w.contentLength = contentLength
+		}
+	}
+
+	if !w.chunked && w.contentLength < 0 && w.hasBody() {
+		w.closeConnection = true
+	}
+	if headers.HasToken("Connection", "close") {
+		w.closeConnection = true
+	}
+	if w.closeConnection {
+		headers.Set("Connection", "close")
+	} else if w.httpVersion == "1.0" {
+		headers.Set("Connection", "keep-alive")
+	}
+}
+
+// hasBody reports whether the response can have a body at all, which is not
+// the case for HEAD requests and for 1xx, 204 and 304 responses (RFC 9110,
+// section 6.4.1). Their end is known without any framing.
+func (w *Writer) hasBody() bool {
+	switch {
+	case w.discardBody, w.statusCode < 200, w.statusCode == StatusNoContent, w.statusCode == StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func (w *Writer) writeHeadersInternal(headers *headers.Headers) error {
 	if err := WriteHeaders(w.Connection, headers); err != nil {
 		return err
 	}
@@ -49,13 +206,29 @@ func (w *Writer) writeHeadersInternal(headers headers.Headers) error {
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
+	n, err := w.writeBody(p)
+	if !w.discardBody {
+		w.bytesWritten += n
+	}
+	return n, err
+}
+
+func (w *Writer) writeBody(p []byte) (int, error) {
 	if w.writerState != WriterBody {
 		return 0, fmt.Errorf("Invalid operation in the current state")
 	}
-	return w.Connection.Write(p)
+	if w.discardBody {
+		return len(p), nil
+	}
+	n, err := w.Connection.Write(p)
+	w.bodyBytesWritten += n
+	return n, err
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.unframed {
+		return w.WriteBody(p)
+	}
 	crlfBytes := []byte(constants.CrLf)
 
 	bodyLength := len(p)
@@ -65,18 +238,37 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	completeBodyChunk = append(completeBodyChunk, bodyLengthLine...)
 	completeBodyChunk = append(completeBodyChunk, p...)
 	completeBodyChunk = append(completeBodyChunk, crlfBytes...)
-	return w.WriteBody(completeBodyChunk)
+	n, err := w.writeBody(completeBodyChunk)
+	if err == nil && !w.discardBody {
+		w.bytesWritten += bodyLength
+	}
+	return n, err
 }
 
 func (w *Writer) WriteChunkedBodyDone(endOfMessage bool) error {
+	if w.unframed {
+		return nil
+	}
 	terminationString := "0" + constants.CrLf
 	if endOfMessage {
 		terminationString += constants.CrLf
 	}
-	_, err := w.WriteBody([]byte(terminationString))
+	_, err := w.writeBody([]byte(terminationString))
+	if err == nil && endOfMessage {
+		w.chunkedDone = true
+	}
 	return err
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	return w.writeHeadersInternal(h)
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if w.unframed || w.discardBody {
+		// trailers cannot be sent without chunked encoding, or without a
+		// body.
+		return nil
+	}
+	if err := w.writeHeadersInternal(h); err != nil {
+		return err
+	}
+	w.chunkedDone = true
+	return nil
 }
@@ -0,0 +1,244 @@
+package router
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+)
+
+type segmentKind int
+
+// the order of the kinds defines their precedence when several patterns match
+// the same path.
+const (
+	segmentStatic segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind segmentKind
+	value string
+}
+
+// anyMethod is the method of routes registered with HandleAll.
+const anyMethod = ""
+
+type route struct {
+	method string
+	pattern string
+	segments []segment
+	handler server.Handler
+}
+
+// Router dispatches requests to handlers registered by method and path
+// pattern. Patterns are made of '/' separated segments, each being either a
+// literal, a named parameter "{name}" matching exactly one segment, or, as the
+// last segment only, a wildcard "{name...}" matching the rest of the path.
+type Router struct {
+	routes []*route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. It panics if the pattern
+// is malformed or already registered for the method.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: invalid pattern '%s': %s", pattern, err))
+	}
+
+	for _, existing := range rt.routes {
+		if existing.method == method && existing.pattern == pattern {
+			if method == anyMethod {
+				panic(fmt.Sprintf("router: pattern '%s' already registered for all methods", pattern))
+			}
+			panic(fmt.Sprintf("router: pattern '%s' already registered for %s", pattern, method))
+		}
+	}
+
+	rt.routes = append(rt.routes, &route{
+		method: method,
+		pattern: pattern,
+		segments: segments,
+		handler: handler,
+	})
+	sort.SliceStable(rt.routes, func(i, j int) bool {
+		return moreSpecific(rt.routes[i], rt.routes[j])
+	})
+}
+
+// HandleAll registers handler for pattern and every method, including
+// methods unknown to the router. Routes registered for the method of a
+// request take precedence. It panics like Handle.
+func (rt *Router) HandleAll(pattern string, handler server.Handler) {
+	rt.Handle(anyMethod, pattern, handler)
+}
+
+// Serve is a server.Handler dispatching to the registered routes. Requests
+// without a matching pattern get a 404, requests matching a pattern only for
+// other methods get a 405 listing the allowed methods. GET routes answer HEAD
+// requests too.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	route, params, allowed := rt.lookup(req.RequestLine.Method, requestPath(req))
+	if route != nil {
+		req.PathParams = params
+		route.handler(w, req)
+		return
+	}
+
+	if len(allowed) > 0 {
+		body := []byte("Method Not Allowed")
+		headers := response.GetDefaultHeaders(len(body))
+		headers.Set("Allow", strings.Join(allowed, ", "))
+		w.WriteStatusLine(response.StatusMethodNotAllowed)
+		w.WriteHeaders(headers)
+		w.WriteBody(body)
+		return
+	}
+
+	body := []byte("Not Found")
+	w.WriteStatusLine(response.StatusNotFound)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// lookup returns the most specific route matching method and path. HEAD
+// requests without a HEAD route are served by the GET route, the writer drops
+// the body, and requests without a route for their method fall back to the
+// routes for all methods. If there is no route, the methods of the routes
+// matching only the path are returned.
+func (rt *Router) lookup(method, path string) (*route, map[string]string, []string) {
+	pathSegments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	var getRoute, anyRoute *route
+	var getParams, anyParams map[string]string
+	allowed := []string{}
+	for _, route := range rt.routes {
+		params, ok := route.match(pathSegments)
+		if !ok {
+			continue
+		}
+		if route.method == method {
+			return route, params, nil
+		}
+		if method == "HEAD" && route.method == "GET" && getRoute == nil {
+			getRoute, getParams = route, params
+		}
+		if route.method == anyMethod {
+			if anyRoute == nil {
+				anyRoute, anyParams = route, params
+			}
+			continue
+		}
+		if !slices.Contains(allowed, route.method) {
+			allowed = append(allowed, route.method)
+		}
+	}
+	if getRoute != nil {
+		return getRoute, getParams, nil
+	}
+	if anyRoute != nil {
+		return anyRoute, anyParams, nil
+	}
+
+	if slices.Contains(allowed, "GET") && !slices.Contains(allowed, "HEAD") {
+		allowed = append(allowed, "HEAD")
+	}
+	slices.Sort(allowed)
+	return nil, nil, allowed
+}
+
+func (r *route) match(pathSegments []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+
+		switch segment.kind {
+		case segmentStatic:
+			if pathSegments[i] != segment.value {
+				return nil, false
+			}
+		case segmentParam:
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[segment.value] = pathSegments[i]
+		case segmentWildcard:
+			params[segment.value] = strings.Join(pathSegments[i:], "/")
+			return params, true
+		}
+	}
+
+	if len(pathSegments) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+func moreSpecific(a, b *route) bool {
+	for i := range min(len(a.segments), len(b.segments)) {
+		if a.segments[i].kind != b.segments[i].kind {
+			return a.segments[i].kind < b.segments[i].kind
+		}
+	}
+	return len(a.segments) > len(b.segments)
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must start with '/'")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	segments := make([]segment, 0, len(parts))
+	names := map[string]struct{}{}
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("segment '%s' is not a valid parameter", part)
+			}
+			segments = append(segments, segment{kind: segmentStatic, value: part})
+			continue
+		}
+
+		name := part[1:len(part) - 1]
+		kind := segmentParam
+		if wildcardName, isWildcard := strings.CutSuffix(name, "..."); isWildcard {
+			if i != len(parts) - 1 {
+				return nil, fmt.Errorf("wildcard '%s' must be the last segment", part)
+			}
+			name = wildcardName
+			kind = segmentWildcard
+		}
+
+		if name == "" || strings.ContainsAny(name, "{}.") {
+			return nil, fmt.Errorf("segment '%s' is not a valid parameter", part)
+		}
+		if _, exists := names[name]; exists {
+			return nil, fmt.Errorf("duplicate parameter name '%s'", name)
+		}
+		names[name] = struct{}{}
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+
+	return segments, nil
+}
+
+func requestPath(req *request.Request) string {
+	if req.URL != nil {
+		return req.URL.Path
+	}
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return path
+}
@@ -0,0 +1,186 @@
+package router
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+	"github.com/MrBhop/httpfromtcp/internal/server"
+	"github.com/MrBhop/httpfromtcp/internal/server/servertest"
+)
+
+func noopHandler(w *response.Writer, req *request.Request) {}
+
+func TestRouterLookup(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/", noopHandler)
+	rt.Handle("GET", "/users/{id}", noopHandler)
+	rt.Handle("DELETE", "/users/{id}", noopHandler)
+	rt.Handle("GET", "/users/me", noopHandler)
+	rt.Handle("POST", "/users/new", noopHandler)
+	rt.Handle("GET", "/static/{path...}", noopHandler)
+
+	// Test: Exact static match
+	route, params, _ := rt.lookup("GET", "/")
+	require.NotNil(t, route)
+	assert.Equal(t, "/", route.pattern)
+	assert.Empty(t, params)
+
+	// Test: Named parameter
+	route, params, _ = rt.lookup("GET", "/users/42")
+	require.NotNil(t, route)
+	assert.Equal(t, "/users/{id}", route.pattern)
+	assert.Equal(t, "42", params["id"])
+
+	// Test: Static segment wins over parameter
+	route, _, _ = rt.lookup("GET", "/users/me")
+	require.NotNil(t, route)
+	assert.Equal(t, "/users/me", route.pattern)
+
+	// Test: Less specific route matching the method wins over a 405
+	route, params, _ = rt.lookup("GET", "/users/new")
+	require.NotNil(t, route)
+	assert.Equal(t, "/users/{id}", route.pattern)
+	assert.Equal(t, "new", params["id"])
+
+	// Test: Wildcard suffix
+	route, params, _ = rt.lookup("GET", "/static/css/site.css")
+	require.NotNil(t, route)
+	assert.Equal(t, "css/site.css", params["path"])
+
+	// Test: Wildcard suffix matching an empty rest
+	route, params, _ = rt.lookup("GET", "/static/")
+	require.NotNil(t, route)
+	assert.Equal(t, "", params["path"])
+
+	// Test: Parameter does not match an empty segment
+	route, _, allowed := rt.lookup("GET", "/users/")
+	assert.Nil(t, route)
+	assert.Empty(t, allowed)
+
+	// Test: Unknown path
+	route, _, allowed = rt.lookup("GET", "/coffee")
+	assert.Nil(t, route)
+	assert.Empty(t, allowed)
+
+	// Test: Known path, unsupported method
+	route, _, allowed = rt.lookup("PUT", "/users/42")
+	assert.Nil(t, route)
+	assert.Equal(t, []string{"DELETE", "GET", "HEAD"}, allowed)
+
+	// Test: HEAD falls back to the GET route
+	route, params, _ = rt.lookup("HEAD", "/users/42")
+	require.NotNil(t, route)
+	assert.Equal(t, "GET", route.method)
+	assert.Equal(t, "42", params["id"])
+
+	// Test: HEAD is allowed wherever GET is
+	route, _, allowed = rt.lookup("POST", "/static/site.css")
+	assert.Nil(t, route)
+	assert.Equal(t, []string{"GET", "HEAD"}, allowed)
+}
+
+func TestRouterHandleAll(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/users/{id}", noopHandler)
+	rt.HandleAll("/users/{id}", noopHandler)
+	rt.Handle("POST", "/{path...}", noopHandler)
+	rt.HandleAll("/{path...}", noopHandler)
+
+	tests := []struct {
+		name string
+		method string
+		path string
+		routeMethod string
+		pattern string
+	}{
+		{"any method", "TRACE", "/users/42", anyMethod, "/users/{id}"},
+		{"unknown method", "PROPFIND", "/users/42", anyMethod, "/users/{id}"},
+		{"custom method", "BREW", "/coffee", anyMethod, "/{path...}"},
+		{"method route wins", "GET", "/users/42", "GET", "/users/{id}"},
+		{"HEAD falls back to GET first", "HEAD", "/users/42", "GET", "/users/{id}"},
+		{"less specific method route wins", "POST", "/users/42", "POST", "/{path...}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			route, _, allowed := rt.lookup(test.method, test.path)
+			require.NotNil(t, route)
+			assert.Equal(t, test.routeMethod, route.method)
+			assert.Equal(t, test.pattern, route.pattern)
+			assert.Empty(t, allowed)
+		})
+	}
+}
+
+func TestRouterServe(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/users/{id}", func(w *response.Writer, req *request.Request) {
+		server.WriteErrorResponse(w, response.StatusOK, "user " + req.PathParams["id"])
+	})
+	rt.Handle("DELETE", "/users/{id}", noopHandler)
+	rt.HandleAll("/any/{path...}", func(w *response.Writer, req *request.Request) {
+		server.WriteErrorResponse(w, response.StatusOK, req.RequestLine.Method + " " + req.PathParams["path"])
+	})
+	conn := servertest.Dial(t, servertest.Serve(t, rt.Serve))
+	reader := response.NewReader(conn)
+	roundTrip := func(method, target string) (*response.Response, string) {
+		_, err := io.WriteString(conn, method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		resp, err := reader.ReadResponseTo(method)
+		require.NoError(t, err)
+		return resp, servertest.ReadBody(t, resp.Body)
+	}
+
+	// Test: Matching route
+	resp, body := roundTrip("GET", "/users/42")
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Equal(t, "user 42", body)
+
+	// Test: Unknown path is answered with 404
+	resp, body = roundTrip("GET", "/coffee")
+	assert.Equal(t, response.StatusNotFound, resp.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found", body)
+
+	// Test: Unsupported method is answered with 405 and the allowed methods
+	resp, body = roundTrip("PUT", "/users/42")
+	assert.Equal(t, response.StatusMethodNotAllowed, resp.StatusLine.StatusCode)
+	allow, _ := resp.Headers.Get("Allow")
+	assert.Equal(t, "DELETE, GET, HEAD", allow)
+	assert.Equal(t, "Method Not Allowed", body)
+
+	// Test: Routes for all methods accept methods unknown to the router
+	resp, body = roundTrip("PROPFIND", "/any/a/b")
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Equal(t, "PROPFIND a/b", body)
+
+	// Test: HEAD is answered by the GET route without a body, keeping the
+	// connection usable for the next request
+	resp, body = roundTrip("HEAD", "/users/42")
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Empty(t, body)
+	length, _ := resp.Headers.Get("Content-Length")
+	assert.Equal(t, "7", length)
+	resp, body = roundTrip("GET", "/users/7")
+	assert.Equal(t, response.StatusOK, resp.StatusLine.StatusCode)
+	assert.Equal(t, "user 7", body)
+}
+
+func TestRouterInvalidPatterns(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/users/{id}", noopHandler)
+
+	assert.Panics(t, func() { rt.Handle("GET", "users", noopHandler) })
+	assert.Panics(t, func() { rt.Handle("GET", "/users/{id}", noopHandler) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{a}/{a}", noopHandler) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{rest...}/tail", noopHandler) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{}", noopHandler) })
+	assert.Panics(t, func() { rt.Handle("GET", "/a{b}", noopHandler) })
+	assert.NotPanics(t, func() { rt.Handle("POST", "/users/{id}", noopHandler) })
+	assert.NotPanics(t, func() { rt.HandleAll("/users/{id}", noopHandler) })
+	assert.Panics(t, func() { rt.HandleAll("/users/{id}", noopHandler) })
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+)
+
+// ErrMissingClientCAs is returned for client authentication without CAs.
+// crypto/tls would verify client certificates against the system roots
+// then, accepting any publicly issued certificate.
+var ErrMissingClientCAs = errors.New("Client authentication requires client CAs")
+
+type ClientAuthMode int
+
+const (
+	// ClientAuthNone does not ask clients for a certificate.
+	ClientAuthNone ClientAuthMode = iota
+	// ClientAuthOptional verifies a client certificate if one is presented,
+	// but also accepts clients without one.
+	ClientAuthOptional
+	// ClientAuthRequired rejects the handshake unless the client presents a
+	// certificate that verifies against the configured CAs.
+	ClientAuthRequired
+)
+
+// LoadCertPool reads the PEM encoded CA certificates in caFile.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+func (s *Server) applyClientAuth(config *tls.Config) error {
+	if s.clientAuth != ClientAuthNone && s.clientCAs == nil {
+		return ErrMissingClientCAs
+	}
+	switch s.clientAuth {
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = s.clientCAs
+	case ClientAuthRequired:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = s.clientCAs
+	}
+	return nil
+}
+
+// verifiedClientIdentity returns the identity of the leaf of the first
+// verified chain. Certificates that were not verified are ignored.
+func verifiedClientIdentity(state *tls.ConnectionState) *request.ClientIdentity {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return request.NewClientIdentity(state.VerifiedChains[0][0])
+}
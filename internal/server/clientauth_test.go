@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+// newCertificate creates a certificate from template signed by parent, or a
+// self-signed one if parent is nil.
+func newCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1 << 62))
+	require.NoError(t, err)
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate, key
+}
+
+func newClientCertificate(t *testing.T, commonName string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) tls.Certificate {
+	spiffeID, err := url.Parse("spiffe://example.test/" + commonName)
+	require.NoError(t, err)
+	certificate, key := newCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		DNSNames: []string{commonName + ".internal.test"},
+		EmailAddresses: []string{commonName + "@example.test"},
+		URIs: []*url.URL{spiffeID},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	return tls.Certificate{
+		Certificate: [][]byte{certificate.Raw},
+		PrivateKey: key,
+	}
+}
+
+// identityHandler answers with the identity of the client certificate.
+func identityHandler(w *response.Writer, req *request.Request) {
+	body := "anonymous"
+	if identity := req.ClientIdentity; identity != nil {
+		body = strings.Join([]string{
+			identity.Subject.CommonName,
+			strings.Join(identity.DNSNames, ","),
+			strings.Join(identity.EmailAddresses, ","),
+			identity.URIs[0].String(),
+		}, " ")
+	}
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody([]byte(body))
+}
+
+func TestClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "server", "server", "localhost")
+	serverCertificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	ca, caKey := newCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Test CA"},
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	untrustedCA, untrustedCAKey := newCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Untrusted CA"},
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	trusted := newClientCertificate(t, "billing", ca, caKey)
+	untrusted := newClientCertificate(t, "intruder", untrustedCA, untrustedCAKey)
+
+	serve := func(mode ClientAuthMode) *Server {
+		s, err := ServeTLS(0, identityHandler, &tls.Config{
+			Certificates: []tls.Certificate{serverCertificate},
+		}, WithClientAuth(mode, clientCAs))
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	// the certificate is presented even if it does not match the CAs the
+	// server asks for, to make sure the server does the verification.
+	get := func(s *Server, clientCertificate *tls.Certificate) (string, error) {
+		conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if clientCertificate == nil {
+					return &tls.Certificate{}, nil
+				}
+				return clientCertificate, nil
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nConnection: close\r\n\r\n")); err != nil {
+			return "", err
+		}
+		raw, err := io.ReadAll(conn)
+		if err != nil {
+			return "", err
+		}
+		_, body, _ := strings.Cut(string(raw), "\r\n\r\n")
+		return body, nil
+	}
+
+	// Test: Required mode accepts a trusted certificate and exposes its identity
+	required := serve(ClientAuthRequired)
+	body, err := get(required, &trusted)
+	require.NoError(t, err)
+	assert.Equal(t, "billing billing.internal.test billing@example.test spiffe://example.test/billing", body)
+
+	// Test: Required mode rejects clients without a certificate
+	_, err = get(required, nil)
+	require.Error(t, err)
+
+	// Test: Required mode rejects untrusted certificates
+	_, err = get(required, &untrusted)
+	require.Error(t, err)
+
+	// Test: Optional mode accepts clients without a certificate
+	optional := serve(ClientAuthOptional)
+	body, err = get(optional, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", body)
+
+	body, err = get(optional, &trusted)
+	require.NoError(t, err)
+	assert.Equal(t, "billing billing.internal.test billing@example.test spiffe://example.test/billing", body)
+
+	// Test: Optional mode still rejects untrusted certificates
+	_, err = get(optional, &untrusted)
+	require.Error(t, err)
+
+	// Test: No client authentication ignores presented certificates
+	none := serve(ClientAuthNone)
+	body, err = get(none, &trusted)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", body)
+
+	// Test: Client authentication without CAs is refused instead of falling
+	// back to the system roots
+	for _, mode := range []ClientAuthMode{ClientAuthOptional, ClientAuthRequired} {
+		_, err = ServeTLS(0, identityHandler, &tls.Config{
+			Certificates: []tls.Certificate{serverCertificate},
+		}, WithClientAuth(mode, nil))
+		require.ErrorIs(t, err, ErrMissingClientCAs)
+	}
+}
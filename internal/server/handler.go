@@ -1,15 +1,49 @@
 package server
 
 import (
+	"errors"
+
 	"github.com/MrBhop/httpfromtcp/internal/request"
 	"github.com/MrBhop/httpfromtcp/internal/response"
 )
 
 type Handler func(w *response.Writer, req *request.Request)
 
+type Middleware func(next Handler) Handler
+
+// ErrorHandler writes the response for a request the server answers itself,
+// because it could not be read or because the handler panicked. The response
+// has not been started yet and the connection is closed afterwards.
+type ErrorHandler func(w *response.Writer, statusCode response.StatusCode, err error)
+
+// Chain wraps handler with the middlewares. The first middleware is the
+// outermost one and sees the request first.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// DefaultErrorHandler answers with the kind of parse error for requests that
+// could not be parsed, and with the reason phrase of the status code
+// otherwise. Details of the error are not sent, they are meant for logs.
+func DefaultErrorHandler(w *response.Writer, statusCode response.StatusCode, err error) {
+	message := response.StatusText(statusCode)
+	var parseErr *request.ParseError
+	if errors.As(err, &parseErr) && parseErr.Kind() != nil {
+		message = parseErr.Kind().Error()
+	}
+	WriteErrorResponse(w, statusCode, message)
+}
+
 func WriteConnectionError(w *response.Writer, message string) {
+	WriteErrorResponse(w, response.StatusBadRequest, message)
+}
+
+func WriteErrorResponse(w *response.Writer, statusCode response.StatusCode, message string) {
 	headers := response.GetDefaultHeaders(len(message))
-	w.WriteStatusLine(response.StatusBadRequest)
+	w.WriteStatusLine(statusCode)
 	w.WriteHeaders(headers)
 	w.WriteBody([]byte(message))
 }
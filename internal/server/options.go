@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/MrBhop/httpfromtcp/internal/accesslog"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+)
+
+type Option func(*Server)
+
+// WithReadHeaderTimeout limits the time to receive the request line and
+// headers, starting with the first byte of the request.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = timeout
+	}
+}
+
+// WithReadBodyTimeout limits the time the handler and the server have to
+// read the request body once the headers were received.
+func WithReadBodyTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readBodyTimeout = timeout
+	}
+}
+
+// WithWriteTimeout limits the time to write the response, starting when the
+// request headers were received.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = timeout
+	}
+}
+
+// WithIdleTimeout limits the time a keep-alive connection may wait for the
+// next request.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithLimits replaces request.DefaultLimits for all connections.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithParserOptions replaces request.StrictParsing for all connections, e.g.
+// with request.LenientParsing for clients that do not follow RFC 9112
+// exactly.
+func WithParserOptions(options request.ParserOptions) Option {
+	return func(s *Server) {
+		s.parserOptions = options
+	}
+}
+
+// WithErrorHandler replaces DefaultErrorHandler to customize the responses
+// the server writes for unreadable requests and panicking handlers.
+func WithErrorHandler(errorHandler ErrorHandler) Option {
+	return func(s *Server) {
+		s.errorHandler = errorHandler
+	}
+}
+
+// WithAccessLog writes an entry to logger for every response, including the
+// ones the server writes for requests it could not parse.
+func WithAccessLog(logger *accesslog.Logger) Option {
+	return func(s *Server) {
+		s.accessLog = logger
+	}
+}
+
+// WithClientAuth enables client certificate authentication against the CAs in
+// clientCAs. It only applies to servers started with ServeTLS, which fails if
+// clientCAs is nil for any mode but ClientAuthNone.
+func WithClientAuth(mode ClientAuthMode, clientCAs *x509.CertPool) Option {
+	return func(s *Server) {
+		s.clientAuth = mode
+		s.clientCAs = clientCAs
+	}
+}
@@ -1,40 +1,96 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/MrBhop/httpfromtcp/internal/accesslog"
 	"github.com/MrBhop/httpfromtcp/internal/request"
 	"github.com/MrBhop/httpfromtcp/internal/response"
 )
 
+// unread request bodies up to this size are discarded to keep the connection
+// alive, larger ones cause the connection to be closed instead.
+const maxBodyDrainBytes = 256 * 1024
+
+// how long to wait for the client to stop sending after answering a request
+// that could not be read, see lingeringClose.
+const lingerTimeout = 500 * time.Millisecond
+
 type Server struct {
 	closed atomic.Bool
 	listener net.Listener
 	handler Handler
+	mu sync.Mutex
+	connections map[net.Conn]connState
+	connectionsChanged chan struct{}
+	onShutdown []func()
+	readHeaderTimeout time.Duration
+	readBodyTimeout time.Duration
+	writeTimeout time.Duration
+	idleTimeout time.Duration
+	limits request.Limits
+	parserOptions request.ParserOptions
+	errorHandler ErrorHandler
+	accessLog *accesslog.Logger
+	clientAuth ClientAuthMode
+	clientCAs *x509.CertPool
 }
 
-func Serve(port int, handlerFunc Handler) (*Server, error) {
+func Serve(port int, handlerFunc Handler, options ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
+	s := newServer(handlerFunc, options)
+	s.start(listener)
+	return s, nil
+}
+
+func newServer(handlerFunc Handler, options []Option) *Server {
 	s := &Server{
-		listener: listener,
 		handler: handlerFunc,
+		connections: map[net.Conn]connState{},
+		connectionsChanged: make(chan struct{}, 1),
+		limits: request.DefaultLimits,
+		errorHandler: DefaultErrorHandler,
+	}
+	for _, option := range options {
+		option(s)
 	}
+	return s
+}
+
+func (s *Server) start(listener net.Listener) {
+	s.listener = listener
 	go s.listen()
-	return s, nil
 }
 
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close immediately closes the listener and all connections, including the
+// ones with requests in flight. Use Shutdown to let them finish first.
 func (s *Server) Close() error {
 	s.closed.Store(true)
+	var err error
 	if s.listener != nil {
-		return s.listener.Close()
+		err = s.listener.Close()
 	}
-	return nil
+	s.closeConnections(false)
+	return err
 }
 
 func (s *Server) listen() {
@@ -47,21 +103,202 @@ func (s *Server) listen() {
 			log.Printf("Error accepting connection: %s\n", err)
 			continue
 		}
+		if !s.trackConnection(conn) {
+			conn.Close()
+			continue
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	defer s.untrackConnection(conn)
 	defer conn.Close()
 
-	response := response.Writer{
-		Connection: conn,
+	conn.SetReadDeadline(deadline(s.readHeaderTimeout))
+	var tlsState *tls.ConnectionState
+	var clientIdentity *request.ClientIdentity
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+		clientIdentity = verifiedClientIdentity(tlsState)
 	}
 
-	request, err := request.RequestFromReader(conn)
-	if err != nil {
-		WriteConnectionError(&response, err.Error())
+	reader := request.NewReader(conn)
+	reader.SetLimits(s.limits)
+	reader.SetParserOptions(s.parserOptions)
+	for {
+		// nothing of the next request was received yet, so a timeout or
+		// error here closes the connection without a response.
+		if err := reader.WaitForData(); err != nil {
+			return
+		}
+		// from now on Shutdown waits for the response instead of closing
+		// the connection under the client sending its request.
+		if !s.setConnectionState(conn, connStateActive) {
+			return
+		}
+		conn.SetReadDeadline(deadline(s.readHeaderTimeout))
+		start := time.Now()
+
+		request, err := reader.ReadRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) || s.closed.Load() {
+				return
+			}
+			conn.SetWriteDeadline(deadline(s.writeTimeout))
+			w := response.NewWriter(conn)
+			w.SetRequestVersion(requestErrorVersion(err))
+			w.CloseAfterResponse()
+			s.errorHandler(w, requestErrorStatus(err), err)
+			s.logAccess(conn, start, nil, w)
+			lingeringClose(conn)
+			return
+		}
+		request.RemoteAddr = conn.RemoteAddr().String()
+		request.TLS = tlsState
+		request.ClientIdentity = clientIdentity
+		conn.SetReadDeadline(deadline(s.readBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.writeTimeout))
+
+		w := response.NewWriter(conn)
+		w.SetRequestVersion(request.RequestLine.HttpVersion)
+		w.SetRequestMethod(request.RequestLine.Method)
+		if !request.KeepAlive() || s.closed.Load() {
+			w.CloseAfterResponse()
+		}
+
+		keepAlive := s.serveRequest(w, request)
+		s.logAccess(conn, start, request, w)
+		if !keepAlive || s.closed.Load() {
+			return
+		}
+		if !request.DiscardBody(maxBodyDrainBytes) {
+			return
+		}
+		if !s.setConnectionState(conn, connStateIdle) {
+			return
+		}
+		conn.SetReadDeadline(deadline(s.idleTimeout))
 	}
+}
 
-	s.handler(&response, request)
+// serveRequest runs the handler for req and reports whether the connection
+// can be used for another request afterwards.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request) bool {
+	if !s.callHandler(w, req) {
+		return false
+	}
+
+	// the handler gave up on a body that could not be read, answer for it
+	// if the response was not started yet.
+	if err := req.BodyErr(); err != nil && w.State() == response.WriterStatusLine {
+		w.CloseAfterResponse()
+		s.errorHandler(w, requestErrorStatus(err), err)
+		return false
+	}
+	return w.KeepAlive()
+}
+
+// callHandler runs the handler, recovering from panics. A panic is answered
+// with a 500 if the response was not started yet. It reports false if the
+// handler panicked, in which case the connection must be closed.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) (ok bool) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		ok = false
+		log.Printf("Panic serving %s %s for %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, req.RemoteAddr, recovered, debug.Stack())
+
+		w.CloseAfterResponse()
+		if w.State() == response.WriterStatusLine {
+			s.errorHandler(w, response.StatusInternalServerError, fmt.Errorf("Handler panicked: %v", recovered))
+		}
+	}()
+
+	s.handler(w, req)
+	return true
+}
+
+// logAccess writes an access log entry for the response written by w. req is
+// nil if the request could not be parsed.
+func (s *Server) logAccess(conn net.Conn, start time.Time, req *request.Request, w *response.Writer) {
+	if s.accessLog == nil {
+		return
+	}
+
+	entry := AccessLogEntry(start, req, w)
+	entry.RemoteAddr = conn.RemoteAddr().String()
+	if err := s.accessLog.Log(entry); err != nil {
+		log.Printf("Error writing access log: %s\n", err)
+	}
+}
+
+// AccessLogEntry describes the response written by w for a request that
+// started at start. req is nil if the request could not be parsed.
+func AccessLogEntry(start time.Time, req *request.Request, w *response.Writer) accesslog.Entry {
+	entry := accesslog.Entry{
+		Time: start,
+		Status: int(w.StatusCode()),
+		BytesWritten: w.BytesWritten(),
+		Duration: time.Since(start),
+	}
+	if req != nil {
+		entry.RemoteAddr = req.RemoteAddr
+		entry.Method = req.RequestLine.Method
+		entry.Target = req.RequestLine.RequestTarget
+		entry.Protocol = "HTTP/" + req.RequestLine.HttpVersion
+		entry.UserAgent, _ = req.Headers.Get("User-Agent")
+		entry.Referer, _ = req.Headers.Get("Referer")
+	}
+	return entry
+}
+
+// requestErrorStatus returns the status code to answer a request with that
+// could not be read because of err.
+func requestErrorStatus(err error) response.StatusCode {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return response.StatusRequestTimeout
+	}
+	var parseErr *request.ParseError
+	if errors.As(err, &parseErr) {
+		return response.StatusCode(parseErr.StatusCode())
+	}
+	return response.StatusBadRequest
+}
+
+// requestErrorVersion returns the HTTP version of a request that could not be
+// read because of err, or "" if its request line was not parsed.
+func requestErrorVersion(err error) string {
+	var parseErr *request.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.HttpVersion
+	}
+	return ""
+}
+
+// lingeringClose stops writing to conn and reads until the client closes its
+// side. The request was only read up to the error, and closing a connection
+// with unread data makes the kernel reset it, which can drop the error
+// response before the client has read it.
+func lingeringClose(conn net.Conn) {
+	if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.Copy(io.Discard, io.LimitReader(conn, maxBodyDrainBytes))
+}
+
+// deadline returns the deadline for a timeout starting now. A timeout of zero
+// means no deadline.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
 }
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/headers"
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+// exchange sends raw to the server and returns everything it answers until
+// the connection is closed.
+func exchange(t *testing.T, s *Server, raw string) string {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = io.WriteString(conn, raw)
+	require.NoError(t, err)
+	answer, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(answer)
+}
+
+// dial connects to the server. The connection is closed when the test ends.
+func dial(t *testing.T, s *Server) net.Conn {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestRequestErrors(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		WriteErrorResponse(w, response.StatusOK, "ok")
+	}, WithLimits(request.Limits{MaxRequestLineBytes: 64, MaxHeaderCount: 2}))
+	require.NoError(t, err)
+	defer s.Close()
+
+	tests := []struct {
+		name string
+		raw string
+		statusLine string
+		body string
+	}{
+		{"malformed request line", "GET /\r\n\r\n", "HTTP/1.1 400 Bad Request", "Malformed request line"},
+		{"unsupported version", "GET / HTTP/2.0\r\n\r\n", "HTTP/1.1 505 HTTP Version Not Supported", "Unsupported HTTP version"},
+		{"request line too long", "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n", "HTTP/1.1 414 URI Too Long", "Request line too long"},
+		{"too many headers", "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", "HTTP/1.1 431 Request Header Fields Too Large", "Too many request header fields"},
+		{"invalid header name", "GET / HTTP/1.1\r\nBad@Name: secret\r\n\r\n", "HTTP/1.1 400 Bad Request", "Invalid header field name"},
+		{"invalid header in HTTP/1.0", "GET / HTTP/1.0\r\nBad@Name: secret\r\n\r\n", "HTTP/1.0 400 Bad Request", "Invalid header field name"},
+		{"unsupported transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", "HTTP/1.1 501 Not Implemented", "Unsupported Transfer-Encoding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			answer := exchange(t, s, test.raw)
+			head, body, found := strings.Cut(answer, "\r\n\r\n")
+			require.True(t, found, answer)
+			assert.True(t, strings.HasPrefix(head, test.statusLine + "\r\n"), head)
+			// details of the error, like the offending input, are not sent.
+			assert.Equal(t, test.body, body)
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	writeErr := make(chan error, 1)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/body":
+			// the server answers for a body that could not be read.
+			if _, err := io.ReadAll(req.Body); err != nil {
+				return
+			}
+		case "/large":
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(256 * 1024 * 1024))
+			chunk := make([]byte, 1024 * 1024)
+			for range 256 {
+				if _, err := w.WriteBody(chunk); err != nil {
+					writeErr <- err
+					return
+				}
+			}
+			writeErr <- nil
+			return
+		}
+		WriteErrorResponse(w, response.StatusOK, "ok")
+	},
+		WithReadHeaderTimeout(50 * time.Millisecond),
+		WithReadBodyTimeout(50 * time.Millisecond),
+		// the write timeout starts with the headers as well, and has to leave
+		// time to answer bodies that time out.
+		WithWriteTimeout(200 * time.Millisecond),
+		WithIdleTimeout(50 * time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer s.Close()
+
+	readAll := func(conn net.Conn) string {
+		answer, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		return string(answer)
+	}
+	assertTimedOut := func(conn net.Conn) {
+		answer := readAll(conn)
+		assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 408 Request Timeout\r\n"), answer)
+	}
+
+	// Test: Headers that stall are answered with 408
+	conn := dial(t, s)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n")
+	require.NoError(t, err)
+	assertTimedOut(conn)
+
+	// Test: Headers trickling in slowly (slowloris) are answered with 408
+	conn = dial(t, s)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n")
+	require.NoError(t, err)
+	go func(conn net.Conn) {
+		for range 20 {
+			time.Sleep(10 * time.Millisecond)
+			if _, err := io.WriteString(conn, "X-Slow: a\r\n"); err != nil {
+				return
+			}
+		}
+	}(conn)
+	assertTimedOut(conn)
+
+	// Test: Connections sending nothing are closed without a response
+	assert.Equal(t, "", readAll(dial(t, s)))
+
+	// Test: A body that stalls is answered with 408
+	conn = dial(t, s)
+	_, err = io.WriteString(conn, "POST /body HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc")
+	require.NoError(t, err)
+	assertTimedOut(conn)
+
+	// Test: Writing to a client that does not read fails at the deadline
+	conn = dial(t, s)
+	_, err = io.WriteString(conn, "GET /large HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	require.ErrorIs(t, <-writeErr, os.ErrDeadlineExceeded)
+
+	// Test: Idle keep-alive connections are closed
+	conn = dial(t, s)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	answer := readAll(conn)
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(answer, "\r\n\r\nok"))
+}
+
+func TestHandlerErrors(t *testing.T) {
+	var handlerCalls atomic.Int32
+	handler := func(w *response.Writer, req *request.Request) {
+		handlerCalls.Add(1)
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("before the response")
+		case "/panic-after":
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(10))
+			w.WriteBody([]byte("part"))
+			panic("during the response")
+		}
+		WriteErrorResponse(w, response.StatusOK, "ok")
+	}
+	s, err := Serve(0, handler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: A panic before the response is answered with 500 and closes the
+	// connection
+	answer := exchange(t, s, "GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 500 Internal Server Error\r\n"), answer)
+	assert.Contains(t, answer, "Connection: close\r\n")
+
+	// Test: A panic during the response aborts the connection
+	answer = exchange(t, s, "GET /panic-after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 200 OK\r\n"), answer)
+	assert.True(t, strings.HasSuffix(answer, "\r\n\r\npart"), answer)
+
+	// Test: The handler is not called for requests that cannot be parsed
+	handlerCalls.Store(0)
+	answer = exchange(t, s, "GET /\r\n\r\n")
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 400 Bad Request\r\n"), answer)
+	assert.Equal(t, int32(0), handlerCalls.Load())
+
+	// Test: A custom error handler answers both
+	var handled []error
+	var mu sync.Mutex
+	s, err = Serve(0, handler, WithErrorHandler(func(w *response.Writer, statusCode response.StatusCode, err error) {
+		mu.Lock()
+		handled = append(handled, err)
+		mu.Unlock()
+		WriteErrorResponse(w, statusCode, fmt.Sprintf("custom %d", statusCode))
+	}))
+	require.NoError(t, err)
+	defer s.Close()
+
+	answer = exchange(t, s, "GET /\r\n\r\n")
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 400 Bad Request\r\n"), answer)
+	assert.True(t, strings.HasSuffix(answer, "\r\n\r\ncustom 400"), answer)
+	answer = exchange(t, s, "GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(answer, "HTTP/1.1 500 Internal Server Error\r\n"), answer)
+	assert.True(t, strings.HasSuffix(answer, "\r\n\r\ncustom 500"), answer)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, handled, 2)
+	assert.ErrorIs(t, handled[0], request.ErrMalformedRequestLine)
+	assert.ErrorContains(t, handled[1], "before the response")
+}
+
+func TestKeepAlive(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		body, _ := io.ReadAll(req.Body)
+		switch req.RequestLine.RequestTarget {
+		case "/no-content":
+			w.WriteStatusLine(response.StatusNoContent)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		case "/not-modified":
+			w.WriteStatusLine(response.StatusNotModified)
+			w.WriteHeaders(headers.NewHeaders())
+			return
+		}
+		WriteErrorResponse(w, response.StatusOK, req.RequestLine.RequestTarget + " " + string(body))
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn := dial(t, s)
+	reader := response.NewReader(conn)
+	readResponse := func() (*response.Response, string) {
+		resp, err := reader.ReadResponse()
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	// Test: The connection is reused for the next request
+	for _, target := range []string{"/first", "/second"} {
+		_, err = io.WriteString(conn, "GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		resp, body := readResponse()
+		assert.True(t, resp.KeepAlive())
+		assert.Equal(t, target + " ", body)
+	}
+
+	// Test: Responses without a body keep the connection without framing
+	for _, target := range []string{"/no-content", "/not-modified"} {
+		_, err = io.WriteString(conn, "GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		resp, body := readResponse()
+		assert.True(t, resp.KeepAlive(), target)
+		_, hasConnection := resp.Headers.Get("Connection")
+		assert.False(t, hasConnection, target)
+		assert.Empty(t, body)
+	}
+
+	// Test: Pipelined requests are answered in order
+	_, err = io.WriteString(conn, "POST /one HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc" +
+		"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, body := readResponse()
+	assert.Equal(t, "/one abc", body)
+	_, body = readResponse()
+	assert.Equal(t, "/two ", body)
+
+	// Test: Connection: close ends the connection after the response
+	_, err = io.WriteString(conn, "GET /last HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, body := readResponse()
+	assert.False(t, resp.KeepAlive())
+	assert.Equal(t, "/last ", body)
+	_, err = reader.ReadResponse()
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,46 @@
+package servertest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/server"
+)
+
+// Serve starts a server for handler on a free local port. It is closed when
+// the test ends.
+func Serve(t *testing.T, handler server.Handler, options ...server.Option) *server.Server {
+	s, err := server.Serve(0, handler, options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// URL returns the http URL of path on s. The server is reached over IPv4, so
+// the client address it sees is known.
+func URL(s *server.Server, path string) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s", s.Addr().(*net.TCPAddr).Port, path)
+}
+
+// Dial connects to s. The connection is closed when the test ends, and
+// gives up after a few seconds so a stuck server fails the test instead of
+// hanging it.
+func Dial(t *testing.T, s *server.Server) net.Conn {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// ReadBody reads body to the end.
+func ReadBody(t *testing.T, body io.Reader) string {
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net"
+)
+
+type connState int
+
+const (
+	// the connection is waiting for the next request.
+	connStateIdle connState = iota
+	// a request is being handled on the connection.
+	connStateActive
+)
+
+// RegisterOnShutdown registers a function to call when Shutdown is called.
+// Each function runs in its own goroutine.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Shutdown stops accepting new connections, closes idle connections and
+// waits for active handlers to finish. If ctx expires first, the remaining
+// connections are closed and the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.mu.Lock()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	for {
+		if s.closeConnections(true) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConnections(false)
+			return ctx.Err()
+		case <-s.connectionsChanged:
+		}
+	}
+}
+
+// closeConnections closes all idle connections, or all connections if
+// idleOnly is false. It reports whether no connections are left.
+func (s *Server) closeConnections(idleOnly bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.connections {
+		if idleOnly && state != connStateIdle {
+			continue
+		}
+		conn.Close()
+		delete(s.connections, conn)
+	}
+	return len(s.connections) == 0
+}
+
+// trackConnection registers a newly accepted connection as idle until the
+// first byte of a request arrives. It reports false if the server is already
+// shutting down.
+func (s *Server) trackConnection(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	s.connections[conn] = connStateIdle
+	return true
+}
+
+func (s *Server) untrackConnection(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, conn)
+	s.notifyConnectionsChanged()
+}
+
+// setConnectionState reports false if the connection was closed by the server
+// in the meantime and must not be used any further.
+func (s *Server) setConnectionState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.connections[conn]; !exists {
+		return false
+	}
+	s.connections[conn] = state
+	if state == connStateIdle {
+		s.notifyConnectionsChanged()
+	}
+	return true
+}
+
+// notifyConnectionsChanged wakes up Shutdown to close connections that just
+// became idle or check whether any are left. Only one notification is kept,
+// which is enough since Shutdown looks at all connections when it wakes up.
+func (s *Server) notifyConnectionsChanged() {
+	select {
+	case s.connectionsChanged <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+// waitForActive waits until n connections of s are handling a request.
+func waitForActive(t *testing.T, s *Server, n int) {
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		active := 0
+		for _, state := range s.connections {
+			if state == connStateActive {
+				active++
+			}
+		}
+		return active == n
+	}, time.Second, time.Millisecond)
+}
+
+// blockingServer serves requests once release is closed, signaling each
+// request on started first.
+func blockingServer(t *testing.T) (s *Server, started chan struct{}, release chan struct{}) {
+	started = make(chan struct{}, 8)
+	release = make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+		WriteErrorResponse(w, response.StatusOK, "ok")
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, started, release
+}
+
+func TestShutdownClosesIdleConnections(t *testing.T) {
+	s, _, release := blockingServer(t)
+	close(release)
+	hookCalled := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hookCalled) })
+
+	// a connection that served a request and one that never sent anything.
+	served := dial(t, s)
+	_, err := io.WriteString(served, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := response.NewReader(served).ReadResponse()
+	require.NoError(t, err)
+	require.True(t, resp.KeepAlive())
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	unused := dial(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	// Test: Idle connections are closed
+	for _, conn := range []net.Conn{served, unused} {
+		_, err = conn.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+	}
+
+	// Test: Hooks run and new connections are refused
+	<-hookCalled
+	_, err = net.Dial("tcp", s.Addr().String())
+	require.Error(t, err)
+}
+
+func TestShutdownWaitsForActiveRequests(t *testing.T) {
+	s, started, release := blockingServer(t)
+
+	// one request is being handled, the other one is still being sent.
+	handled := dial(t, s)
+	_, err := io.WriteString(handled, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+	sending := dial(t, s)
+	_, err = io.WriteString(sending, "GET / HTTP/1.1\r\n")
+	require.NoError(t, err)
+	waitForActive(t, s, 2)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned before the requests were answered: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Test: Both requests are answered in full and the connections closed
+	_, err = io.WriteString(sending, "Host: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+	close(release)
+	for _, conn := range []net.Conn{handled, sending} {
+		answer, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.Contains(t, string(answer), "HTTP/1.1 200 OK\r\n")
+		assert.Contains(t, string(answer), "\r\n\r\nok")
+		if conn == sending {
+			// the request was read after Shutdown was called.
+			assert.Contains(t, string(answer), "Connection: close\r\n")
+		}
+	}
+	require.NoError(t, <-done)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	s, started, release := blockingServer(t)
+	defer close(release)
+	hookCalled := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hookCalled) })
+
+	conn := dial(t, s)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	// Test: Connections left at the deadline are closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	answer, _ := io.ReadAll(conn)
+	assert.Empty(t, answer)
+
+	// Test: Hooks run
+	<-hookCalled
+}
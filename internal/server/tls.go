@@ -0,0 +1,178 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const DefaultCertificateReloadInterval = 10 * time.Second
+
+var ErrMissingTLSConfig = errors.New("TLS config is required to serve TLS")
+
+// ServeTLS is like Serve, but terminates TLS on every connection using
+// tlsConfig, which must provide the certificates.
+func ServeTLS(port int, handlerFunc Handler, tlsConfig *tls.Config, options ...Option) (*Server, error) {
+	if tlsConfig == nil {
+		return nil, ErrMissingTLSConfig
+	}
+	s := newServer(handlerFunc, options)
+
+	config := tlsConfig.Clone()
+	if !slices.Contains(config.NextProtos, "http/1.1") {
+		config.NextProtos = append(config.NextProtos, "http/1.1")
+	}
+	if err := s.applyClientAuth(config); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	s.start(tls.NewListener(listener, config))
+	return s, nil
+}
+
+// ServeTLSFiles is like ServeTLS, using the PEM encoded certificate and key
+// from disk. The files are reloaded when they change.
+func ServeTLSFiles(port int, handlerFunc Handler, certFile, keyFile string, options ...Option) (*Server, error) {
+	store := NewCertificateStore()
+	if err := store.Add(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return ServeTLS(port, handlerFunc, &tls.Config{GetCertificate: store.GetCertificate}, options...)
+}
+
+// CertificateStore holds certificates loaded from disk and picks the one
+// matching the server name the client asked for (SNI), falling back to the
+// first certificate added. The files are checked for changes during
+// handshakes at most once per reload interval, so renewed certificates are
+// served without a restart.
+type CertificateStore struct {
+	mu sync.Mutex
+	pairs []*certificatePair
+	reloadInterval time.Duration
+	lastCheck time.Time
+}
+
+type certificatePair struct {
+	certFile string
+	keyFile string
+	modTime time.Time
+	certificate *tls.Certificate
+}
+
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		reloadInterval: DefaultCertificateReloadInterval,
+	}
+}
+
+// SetReloadInterval changes how often the files are checked for changes. An
+// interval of zero disables automatic reloading, Reload still works.
+func (c *CertificateStore) SetReloadInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloadInterval = interval
+}
+
+// Add loads a certificate and key pair and keeps watching the files.
+func (c *CertificateStore) Add(certFile, keyFile string) error {
+	pair := &certificatePair{
+		certFile: certFile,
+		keyFile: keyFile,
+	}
+	if err := pair.load(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pairs = append(c.pairs, pair)
+	return nil
+}
+
+// Reload reloads every pair whose files changed since they were loaded. A
+// pair that fails to load keeps serving its previous certificate.
+func (c *CertificateStore) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reload()
+}
+
+func (c *CertificateStore) reload() error {
+	c.lastCheck = time.Now()
+	var firstErr error
+	for _, pair := range c.pairs {
+		modTime, err := pair.currentModTime()
+		if err == nil && modTime.Equal(pair.modTime) {
+			continue
+		}
+		if err == nil {
+			err = pair.load()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("Error reloading certificate %s: %w", pair.certFile, err)
+		}
+	}
+	return firstErr
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (c *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reloadInterval > 0 && time.Since(c.lastCheck) >= c.reloadInterval {
+		if err := c.reload(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if len(c.pairs) == 0 {
+		return nil, fmt.Errorf("No certificates configured")
+	}
+	for _, pair := range c.pairs {
+		if hello.SupportsCertificate(pair.certificate) == nil {
+			return pair.certificate, nil
+		}
+	}
+	return c.pairs[0].certificate, nil
+}
+
+func (p *certificatePair) load() error {
+	modTime, err := p.currentModTime()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	p.certificate = &certificate
+	p.modTime = modTime
+	return nil
+}
+
+// currentModTime returns the latest modification time of both files.
+func (p *certificatePair) currentModTime() (time.Time, error) {
+	certInfo, err := os.Stat(p.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(p.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
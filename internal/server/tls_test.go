@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MrBhop/httpfromtcp/internal/request"
+	"github.com/MrBhop/httpfromtcp/internal/response"
+)
+
+// writeSelfSignedCert generates a self-signed certificate for dnsNames and
+// writes it and its key as PEM files into dir.
+func writeSelfSignedCert(t *testing.T, dir, name, commonName string, dnsNames ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1 << 62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name + ".crt")
+	keyFile := filepath.Join(dir, name + ".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+// peerCommonName connects to the server using serverName for SNI and returns
+// the common name of the certificate the server presented.
+func peerCommonName(t *testing.T, s *Server, serverName string) string {
+	conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{
+		ServerName: serverName,
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	defaultCert, defaultKey := writeSelfSignedCert(t, dir, "default", "default", "localhost")
+	otherCert, otherKey := writeSelfSignedCert(t, dir, "other", "other", "other.test", "*.other.test")
+
+	store := NewCertificateStore()
+	store.SetReloadInterval(0)
+	require.NoError(t, store.Add(defaultCert, defaultKey))
+	require.NoError(t, store.Add(otherCert, otherKey))
+
+	s, err := ServeTLS(0, func(w *response.Writer, req *request.Request) {
+		body := []byte("no tls")
+		if req.TLS != nil {
+			body = []byte(tls.VersionName(req.TLS.Version) + " " + req.TLS.ServerName)
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, &tls.Config{GetCertificate: store.GetCertificate, MinVersion: tls.VersionTLS12})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Request over TLS exposes the connection state
+	conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{
+		ServerName: "localhost",
+		InsecureSkipVerify: true,
+		MaxVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	})
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Contains(t, string(raw), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, string(raw), "\r\n\r\nTLS 1.2 localhost")
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+
+	// Test: Certificate is selected by SNI, including wildcards
+	assert.Equal(t, "default", peerCommonName(t, s, "localhost"))
+	assert.Equal(t, "other", peerCommonName(t, s, "other.test"))
+	assert.Equal(t, "other", peerCommonName(t, s, "api.other.test"))
+
+	// Test: Unknown server names get the first certificate
+	assert.Equal(t, "default", peerCommonName(t, s, "unknown.test"))
+
+	// Test: Certificates are reloaded from disk
+	writeSelfSignedCert(t, dir, "other", "renewed", "other.test")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(otherCert, later, later))
+	require.NoError(t, store.Reload())
+	assert.Equal(t, "renewed", peerCommonName(t, s, "other.test"))
+
+	// Test: A broken file keeps the previous certificate
+	require.NoError(t, os.WriteFile(otherCert, []byte("garbage"), 0600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(otherCert, later, later))
+	require.Error(t, store.Reload())
+	assert.Equal(t, "renewed", peerCommonName(t, s, "other.test"))
+
+	// Test: A missing config is reported instead of panicking
+	_, err = ServeTLS(0, func(w *response.Writer, req *request.Request) {}, nil)
+	require.ErrorIs(t, err, ErrMissingTLSConfig)
+}
+
+func TestServeTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "server", "first", "localhost")
+
+	s, err := ServeTLSFiles(0, func(w *response.Writer, req *request.Request) {}, certFile, keyFile)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "first", peerCommonName(t, s, "localhost"))
+
+	// Test: Missing files are reported at startup
+	_, err = ServeTLSFiles(0, func(w *response.Writer, req *request.Request) {}, filepath.Join(dir, "missing.crt"), keyFile)
+	require.Error(t, err)
+}